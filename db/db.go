@@ -1 +1,224 @@
 package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	_ "modernc.org/sqlite" // pure go sqlite driver registered as "sqlite"
+)
+
+// Options for the database connection and pool
+type Options struct {
+	Driver          string        `toml:"driver" json:"driver" comment:"database/sql driver name (default sqlite)"`
+	DSN             string        `toml:"dsn" json:"dsn" comment:"data source name for the database connection"`
+	MaxOpenConns    int           `toml:"max_open_conns" json:"max_open_conns" comment:"max number of open connections (0 is unlimited)"`
+	MaxIdleConns    int           `toml:"max_idle_conns" json:"max_idle_conns" comment:"max number of idle connections kept in the pool (0 is the database/sql default of 2)"`
+	ConnMaxLifetime time.Duration `toml:"conn_max_lifetime" json:"conn_max_lifetime" comment:"max amount of time a connection may be reused"`
+	ConnMaxIdleTime time.Duration `toml:"conn_max_idle_time" json:"conn_max_idle_time" comment:"max amount of time a connection may be idle"`
+	QueryTimeout    time.Duration `toml:"query_timeout" json:"query_timeout" comment:"timeout applied to each query (0 is no timeout)"`
+	AutoMigrate     bool          `toml:"auto_migrate" json:"auto_migrate" comment:"apply pending migrations on startup"`
+}
+
+// DB is the connection manager for the api database
+type DB struct {
+	*sql.DB
+	timeout time.Duration
+	driver  string
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx
+// so the query helpers can be used inside or outside of a transaction
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Scanner is satisfied by both *sql.Row and *sql.Rows
+type Scanner interface {
+	Scan(dest ...any) error
+}
+
+// ScanFunc reads a single row into a value
+type ScanFunc[T any] func(s Scanner) (T, error)
+
+var conn *DB
+
+var tracer = otel.Tracer("github.com/rest-api/db")
+
+// Open will create the connection pool and verify the connection,
+// the pool is then available from Conn(). The pool settings are only
+// changed when they're set, database/sql's defaults are used otherwise
+func Open(o *Options) error {
+	if o == nil {
+		o = &Options{}
+	}
+	driver, dsn := o.Driver, o.DSN
+	if driver == "" {
+		driver = "sqlite"
+	}
+	if dsn == "" {
+		dsn = "file:rest-api.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	}
+
+	d, err := sql.Open(driver, dsn)
+	if err != nil {
+		return fmt.Errorf("could not open %s database %w", driver, err)
+	}
+
+	if o.MaxOpenConns > 0 {
+		d.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns > 0 {
+		d.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime > 0 {
+		d.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+	if o.ConnMaxIdleTime > 0 {
+		d.SetConnMaxIdleTime(o.ConnMaxIdleTime)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := d.PingContext(ctx); err != nil {
+		d.Close()
+		return fmt.Errorf("could not connect to %s database %w", driver, err)
+	}
+
+	conn = &DB{DB: d, timeout: o.QueryTimeout, driver: driver}
+	return nil
+}
+
+// Conn returns the open database connection pool
+func Conn() *DB {
+	return conn
+}
+
+// Close will close the database connection pool,
+// the signature matches a setup.ShutdownHook
+func Close(ctx context.Context) error {
+	if conn == nil {
+		return nil
+	}
+	return conn.DB.Close()
+}
+
+// Ping checks the database can be reached,
+// the signature matches a setup.CheckFunc
+func Ping(ctx context.Context) error {
+	if conn == nil {
+		return errors.New("db is not open")
+	}
+	return conn.PingContext(ctx)
+}
+
+// withTimeout applies the configured query timeout to the context
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if conn == nil || conn.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, conn.timeout)
+}
+
+// startSpan starts a child span for the query
+func startSpan(ctx context.Context, op, query string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("db.operation", op)}
+	if conn != nil {
+		attrs = append(attrs, attribute.String("db.system", conn.driver))
+	}
+	if query != "" {
+		attrs = append(attrs, attribute.String("db.statement", query))
+	}
+	return tracer.Start(ctx, "db."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// endSpan records the error on the span, sql.ErrNoRows is not an error
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Exec runs a statement that doesn't return rows
+func Exec(ctx context.Context, q Querier, query string, args ...any) (res sql.Result, err error) {
+	ctx, span := startSpan(ctx, "exec", query)
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return q.ExecContext(ctx, query, args...)
+}
+
+// Get runs a query expected to return a single row,
+// sql.ErrNoRows is returned when no row is found
+func Get[T any](ctx context.Context, q Querier, scan ScanFunc[T], query string, args ...any) (v T, err error) {
+	ctx, span := startSpan(ctx, "get", query)
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	return scan(q.QueryRowContext(ctx, query, args...))
+}
+
+// Select runs a query and scans every returned row
+func Select[T any](ctx context.Context, q Querier, scan ScanFunc[T], query string, args ...any) (list []T, err error) {
+	ctx, span := startSpan(ctx, "select", query)
+	defer func() { endSpan(span, err) }()
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list = make([]T, 0)
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+
+	return list, rows.Err()
+}
+
+// Tx runs fn inside of a transaction, the transaction is committed
+// when fn returns nil and rolled back when fn returns an error or panics
+func (d *DB) Tx(ctx context.Context, fn func(tx *sql.Tx) error) (err error) {
+	ctx, span := startSpan(ctx, "tx", "")
+	defer func() { endSpan(span, err) }()
+
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("could not begin transaction %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+				err = fmt.Errorf("%w (rollback error %v)", err, rbErr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	return fn(tx)
+}
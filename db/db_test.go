@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDB opens a new in-memory sqlite database for the test,
+// the shared cache keeps one database for every connection in the pool
+func testDB(t *testing.T) {
+	t.Helper()
+	dsn := "file:" + strings.ReplaceAll(t.Name(), "/", "_") + "?mode=memory&cache=shared&_pragma=busy_timeout(5000)"
+	if err := Open(&Options{DSN: dsn}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		Close(context.Background())
+		conn = nil
+	})
+}
+
+type row struct {
+	ID   int
+	Name string
+}
+
+func scanRow(s Scanner) (r row, err error) {
+	err = s.Scan(&r.ID, &r.Name)
+	return r, err
+}
+
+// testTable creates a table with the rows
+func testTable(t *testing.T, names ...string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := Exec(ctx, Conn(), `CREATE TABLE toys (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE)`); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range names {
+		if _, err := Exec(ctx, Conn(), `INSERT INTO toys (name) VALUES (?)`, n); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	o := &Options{DSN: "file:open?mode=memory&cache=shared"}
+	if err := Open(o); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		Close(context.Background())
+		conn = nil
+	}()
+	if o.Driver != "" || o.MaxIdleConns != 0 {
+		t.Errorf("the options were changed %+v", o)
+	}
+	if conn.driver != "sqlite" {
+		t.Errorf("expected the sqlite driver, got %s", conn.driver)
+	}
+	if err := Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// the default pool keeps idle connections
+	if _, err := Exec(context.Background(), Conn(), `SELECT 1`); err != nil {
+		t.Fatal(err)
+	}
+	if s := Conn().Stats(); s.Idle != 1 || s.MaxOpenConnections != 0 {
+		t.Errorf("expected an idle connection and no open limit, got %+v", s)
+	}
+	Close(context.Background())
+
+	if err := Open(&Options{DSN: "file:open?mode=memory&cache=shared", MaxOpenConns: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if n := Conn().Stats().MaxOpenConnections; n != 3 {
+		t.Errorf("expected 3 max open connections, got %d", n)
+	}
+
+	if err := Open(&Options{Driver: "nope"}); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("expected an unknown driver error, got %v", err)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	testDB(t)
+	testTable(t, "mouse", "yarn", "box")
+	ctx := context.Background()
+
+	r, err := Get(ctx, Conn(), scanRow, `SELECT id, name FROM toys WHERE name = ?`, "yarn")
+	if err != nil || r != (row{ID: 2, Name: "yarn"}) {
+		t.Errorf("unexpected row %+v %v", r, err)
+	}
+	if _, err := Get(ctx, Conn(), scanRow, `SELECT id, name FROM toys WHERE id = ?`, 9); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows, got %v", err)
+	}
+
+	rows, err := Select(ctx, Conn(), scanRow, `SELECT id, name FROM toys WHERE id > ? ORDER BY id`, 1)
+	if err != nil || len(rows) != 2 || rows[1].Name != "box" {
+		t.Errorf("unexpected rows %+v %v", rows, err)
+	}
+	rows, err = Select(ctx, Conn(), scanRow, `SELECT id, name FROM toys WHERE id > 9`)
+	if err != nil || rows == nil || len(rows) != 0 {
+		t.Errorf("expected an empty list, got %#v %v", rows, err)
+	}
+	if _, err := Select(ctx, Conn(), scanRow, `SELECT nope FROM toys`); err == nil {
+		t.Error("expected a query error")
+	}
+
+	res, err := Exec(ctx, Conn(), `DELETE FROM toys WHERE id = ?`, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("expected 1 deleted row, got %d", n)
+	}
+
+	conn.timeout = time.Nanosecond
+	defer func() { conn.timeout = 0 }()
+	if _, err := Exec(ctx, Conn(), `DELETE FROM toys`); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the query timeout, got %v", err)
+	}
+}
+
+func TestTx(t *testing.T) {
+	testDB(t)
+	testTable(t, "mouse")
+	ctx := context.Background()
+	insert := func(name string) func(tx *sql.Tx) error {
+		return func(tx *sql.Tx) error {
+			_, err := Exec(ctx, tx, `INSERT INTO toys (name) VALUES (?)`, name)
+			return err
+		}
+	}
+	count := func() int {
+		n, err := Get(ctx, Conn(), func(s Scanner) (n int, err error) {
+			err = s.Scan(&n)
+			return n, err
+		}, `SELECT COUNT(*) FROM toys`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	if err := Conn().Tx(ctx, insert("yarn")); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 2 {
+		t.Errorf("expected the insert to be committed, got %d rows", n)
+	}
+
+	err := Conn().Tx(ctx, func(tx *sql.Tx) error {
+		if err := insert("box")(tx); err != nil {
+			return err
+		}
+		return insert("mouse")(tx) // unique name
+	})
+	if err == nil {
+		t.Error("expected the unique constraint error")
+	}
+	if n := count(); n != 2 {
+		t.Errorf("expected the insert to be rolled back, got %d rows", n)
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("expected the panic to be re-panicked, got %v", p)
+			}
+		}()
+		Conn().Tx(ctx, func(tx *sql.Tx) error {
+			insert("box")(tx)
+			panic("boom")
+		})
+	}()
+	if n := count(); n != 2 {
+		t.Errorf("expected the panicked insert to be rolled back, got %d rows", n)
+	}
+}
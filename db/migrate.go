@@ -0,0 +1,390 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migration files are named {version}_{name}.up.sql and {version}_{name}.down.sql
+// i.e., 0001_create_kittns.up.sql, versions must be unique and are applied in order
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	lockTimeout = time.Minute      // how long to wait for another instance to finish migrating
+	staleLock   = 10 * time.Minute // a lock older than this is considered abandoned
+
+	// extended sqlite result codes for a duplicate key
+	sqliteConstraintPrimaryKey = 1555
+	sqliteConstraintUnique     = 2067
+)
+
+// lockRefresh is how often a held lock's locked_at is updated
+// so a long migration isn't mistaken for a stale lock
+var lockRefresh = staleLock / 5
+
+// dryRunOut is where a dry run prints the statements
+var dryRunOut io.Writer = os.Stdout
+
+// Migration is a single versioned schema change
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of the up statements
+}
+
+type applied struct {
+	Version  int
+	Checksum string
+}
+
+// Migrations returns the embedded migrations sorted by version
+func Migrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, f := range files {
+		base := path.Base(f)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("migration %s must end with .up.sql or .down.sql", base)
+		}
+
+		name := strings.TrimSuffix(base, "."+direction+".sql")
+		v, label, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s must start with a version number %w", base, err)
+		}
+
+		b, err := migrationFiles.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		m, found := byVersion[version]
+		if !found {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if m.Name != label {
+			return nil, fmt.Errorf("duplicate migration version %d (%s, %s)", version, m.Name, label)
+		}
+		if direction == "up" {
+			m.Up = string(b)
+			sum := sha256.Sum256(b)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing the up file", m.Version, m.Name)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+	return list, nil
+}
+
+// MigrateUp applies all pending migrations, each in its own transaction.
+// With dryRun the pending statements are printed and nothing is applied
+func MigrateUp(ctx context.Context, dryRun bool) error {
+	return migrate(ctx, dryRun, func(ms []Migration, done map[int]applied) error {
+		for _, m := range ms {
+			if _, found := done[m.Version]; found {
+				continue
+			}
+			err := apply(ctx, m, m.Up, "applied", dryRun, func(tx *sql.Tx) error {
+				_, err := Exec(ctx, tx,
+					`INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)`,
+					m.Version, m.Name, m.Checksum, time.Now().UTC())
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateDown rolls back the last n applied migrations.
+// With dryRun the statements are printed and nothing is applied
+func MigrateDown(ctx context.Context, n int, dryRun bool) error {
+	return migrate(ctx, dryRun, func(ms []Migration, done map[int]applied) error {
+		for i := len(ms) - 1; i >= 0 && n > 0; i-- {
+			m := ms[i]
+			if _, found := done[m.Version]; !found {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+			}
+			err := apply(ctx, m, m.Down, "rolled back", dryRun, func(tx *sql.Tx) error {
+				_, err := Exec(ctx, tx, `DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			n--
+		}
+		return nil
+	})
+}
+
+// migrate holds the migration lock, validates the applied migrations
+// against the embedded files and then calls fn. A dry run only reads the
+// history, it doesn't create the history or lock tables
+func migrate(ctx context.Context, dryRun bool, fn func([]Migration, map[int]applied) error) error {
+	if conn == nil {
+		return errors.New("db connection is not open")
+	}
+
+	ms, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	if !dryRun {
+		_, err = Exec(ctx, conn, `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			checksum   TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`)
+		if err != nil {
+			return fmt.Errorf("could not create schema_migrations table %w", err)
+		}
+
+		release, err := lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+
+	done, err := Select(ctx, conn, func(s Scanner) (a applied, err error) {
+		err = s.Scan(&a.Version, &a.Checksum)
+		return a, err
+	}, `SELECT version, checksum FROM schema_migrations`)
+	if err != nil {
+		if !dryRun {
+			return fmt.Errorf("could not read schema_migrations %w", err)
+		}
+		// the history table is created by the first migration that's applied
+		fmt.Fprintf(dryRunOut, "-- could not read schema_migrations, every migration is pending (%v)\n", err)
+		done = nil
+	}
+
+	known := make(map[int]Migration)
+	for _, m := range ms {
+		known[m.Version] = m
+	}
+	doneMap := make(map[int]applied)
+	for _, a := range done {
+		m, found := known[a.Version]
+		if !found {
+			return fmt.Errorf("applied migration %d is missing from the migration files", a.Version)
+		}
+		if m.Checksum != a.Checksum {
+			return fmt.Errorf("checksum mismatch for applied migration %d_%s, the file has changed since it was applied",
+				m.Version, m.Name)
+		}
+		doneMap[a.Version] = a
+	}
+
+	return fn(ms, doneMap)
+}
+
+// apply runs the statements and the history update in a single transaction
+func apply(ctx context.Context, m Migration, stmts, action string, dryRun bool, history func(tx *sql.Tx) error) error {
+	if dryRun {
+		fmt.Fprintf(dryRunOut, "-- %04d_%s\n", m.Version, m.Name)
+		for _, s := range splitStatements(stmts) {
+			fmt.Fprintf(dryRunOut, "%s;\n", s)
+		}
+		return nil
+	}
+
+	err := conn.Tx(ctx, func(tx *sql.Tx) error {
+		for _, s := range splitStatements(stmts) {
+			if _, err := Exec(ctx, tx, s); err != nil {
+				return err
+			}
+		}
+		return history(tx)
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s failed %w", m.Version, m.Name, err)
+	}
+
+	slog.Info(action+" migration", "version", m.Version, "name", m.Name)
+	return nil
+}
+
+// lock acquires the migration lock so concurrent instances can't race, the lock is refreshed
+// while it's held and the returned func releases it. Only a duplicate key error means
+// another instance holds the lock, any other error is returned right away
+func lock(ctx context.Context) (func(), error) {
+	_, err := Exec(ctx, conn, `CREATE TABLE IF NOT EXISTS schema_migrations_lock (
+		id        INTEGER PRIMARY KEY,
+		owner     TEXT NOT NULL,
+		locked_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("could not create schema_migrations_lock table %w", err)
+	}
+
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano())
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		_, err = Exec(ctx, conn,
+			`INSERT INTO schema_migrations_lock (id, owner, locked_at) VALUES (1, ?, ?)`,
+			owner, time.Now().UTC())
+		if err == nil {
+			break
+		}
+		if !isDuplicate(err) {
+			return nil, fmt.Errorf("could not take the migration lock %w", err)
+		}
+
+		// remove a lock left behind by an instance that died mid migration
+		res, dErr := Exec(ctx, conn, `DELETE FROM schema_migrations_lock WHERE id = 1 AND locked_at < ?`,
+			time.Now().UTC().Add(-staleLock))
+		if n, _ := rowsAffected(res, dErr); n > 0 {
+			slog.Warn("removed stale migration lock")
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for the migration lock %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	d := conn
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		t := time.NewTicker(lockRefresh)
+		defer t.Stop()
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				_, err := Exec(context.Background(), d,
+					`UPDATE schema_migrations_lock SET locked_at = ? WHERE id = 1 AND owner = ?`, time.Now().UTC(), owner)
+				if err != nil {
+					slog.Error("could not refresh migration lock", "error", err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		_, err := Exec(context.Background(), d,
+			`DELETE FROM schema_migrations_lock WHERE id = 1 AND owner = ?`, owner)
+		if err != nil {
+			slog.Error("could not release migration lock", "error", err)
+		}
+	}, nil
+}
+
+// isDuplicate returns true for a unique or primary key violation, the sqlite
+// result code is checked and other drivers are matched by their error message
+func isDuplicate(err error) bool {
+	var coded interface{ Code() int }
+	if errors.As(err, &coded) {
+		code := coded.Code()
+		return code == sqliteConstraintPrimaryKey || code == sqliteConstraintUnique
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "duplicate") || strings.Contains(msg, "unique constraint")
+}
+
+func rowsAffected(res sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// splitStatements splits sql on semicolons that are not
+// inside of quotes or comments, empty statements are dropped
+func splitStatements(s string) []string {
+	var stmts []string
+	var b strings.Builder
+	var quote rune
+	comment := false
+
+	for i, c := range s {
+		switch {
+		case comment:
+			if c == '\n' {
+				comment = false
+			}
+		case quote != 0:
+			b.WriteRune(c)
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			b.WriteRune(c)
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			comment = true
+		case c == ';':
+			if stmt := strings.TrimSpace(b.String()); stmt != "" {
+				stmts = append(stmts, stmt)
+			}
+			b.Reset()
+		default:
+			b.WriteRune(c)
+		}
+	}
+	if stmt := strings.TrimSpace(b.String()); stmt != "" {
+		stmts = append(stmts, stmt)
+	}
+
+	return stmts
+}
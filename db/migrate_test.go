@@ -0,0 +1,244 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tables(t *testing.T) []string {
+	t.Helper()
+	names, err := Select(context.Background(), conn, func(s Scanner) (n string, err error) {
+		err = s.Scan(&n)
+		return n, err
+	}, `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func kittnIDs(t *testing.T) []int {
+	t.Helper()
+	ids, err := Select(context.Background(), conn, func(s Scanner) (id int, err error) {
+		err = s.Scan(&id)
+		return id, err
+	}, `SELECT id FROM kittns ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestMigrations(t *testing.T) {
+	ms, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) < 2 || ms[0].Version != 1 || ms[1].Version != 2 {
+		t.Fatalf("expected the migrations in version order, got %v", ms)
+	}
+	for _, m := range ms {
+		if m.Up == "" || m.Down == "" || len(m.Checksum) != 64 {
+			t.Errorf("migration %d_%s is incomplete", m.Version, m.Name)
+		}
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	testDB(t)
+	out := &bytes.Buffer{}
+	dryRunOut = out
+	defer func() { dryRunOut = os.Stdout }()
+
+	if err := MigrateUp(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if names := tables(t); len(names) != 0 {
+		t.Errorf("a dry run shouldn't create tables, got %v", names)
+	}
+	if !strings.Contains(out.String(), "-- 0001_create_kittns\nCREATE TABLE kittns") || !strings.Contains(out.String(), "-- 0002_seed_kittns") {
+		t.Errorf("expected the pending statements, got\n%s", out)
+	}
+
+	if err := MigrateUp(context.Background(), false); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := MigrateDown(context.Background(), 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "-- 0002_seed_kittns\nDELETE FROM kittns WHERE id IN (1, 2);\n" {
+		t.Errorf("expected the seed rollback, got\n%s", out)
+	}
+	if ids := kittnIDs(t); len(ids) != 2 {
+		t.Errorf("a dry run shouldn't remove kittns, got %v", ids)
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+
+	if err := MigrateUp(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateUp(ctx, false); err != nil {
+		t.Fatalf("applying again should be a no-op %v", err)
+	}
+	if want := []string{"kittns", "schema_migrations", "schema_migrations_lock"}; strings.Join(tables(t), ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, tables(t))
+	}
+
+	// a kittn with a seeded name isn't removed by the seed rollback
+	if _, err := Exec(ctx, conn, `INSERT INTO kittns (name, breed) VALUES ('Max', 'tabby')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateDown(ctx, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	if ids := kittnIDs(t); len(ids) != 1 || ids[0] != 3 {
+		t.Errorf("expected only the seeded kittns to be removed, got %v", ids)
+	}
+
+	if err := MigrateDown(ctx, 5, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"schema_migrations", "schema_migrations_lock"}; strings.Join(tables(t), ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, tables(t))
+	}
+}
+
+func TestMigrateChecksum(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+	if err := MigrateUp(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+
+	Exec(ctx, conn, `UPDATE schema_migrations SET checksum = 'changed' WHERE version = 1`)
+	if err := MigrateUp(ctx, false); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got %v", err)
+	}
+
+	Exec(ctx, conn, `INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (999, 'gone', 'x', ?)`, time.Now())
+	Exec(ctx, conn, `DELETE FROM schema_migrations WHERE version = 1`)
+	if err := MigrateUp(ctx, false); err == nil || !strings.Contains(err.Error(), "missing from the migration files") {
+		t.Errorf("expected a missing migration, got %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+
+	release, err := lock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another instance waits for the lock
+	wait, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if _, err := lock(wait); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to wait for the held lock, got %v", err)
+	}
+	if err := MigrateUp(wait, false); err == nil {
+		t.Fatal("expected migrate to wait for the held lock")
+	}
+
+	release()
+	release, err = lock(ctx)
+	if err != nil {
+		t.Fatalf("expected the released lock to be taken %v", err)
+	}
+	release()
+
+	// a lock left by an instance that died is removed
+	Exec(ctx, conn, `INSERT INTO schema_migrations_lock (id, owner, locked_at) VALUES (1, 'dead', ?)`, time.Now().UTC().Add(-2*staleLock))
+	release, err = lock(ctx)
+	if err != nil {
+		t.Fatalf("expected the stale lock to be replaced %v", err)
+	}
+	release()
+}
+
+func TestLockRefresh(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+	defer func(d time.Duration) { lockRefresh = d }(lockRefresh)
+	lockRefresh = 10 * time.Millisecond
+
+	release, err := lock(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	// a long migration keeps its lock fresh so it isn't removed as stale
+	old := time.Now().UTC().Add(-2 * staleLock)
+	Exec(ctx, conn, `UPDATE schema_migrations_lock SET locked_at = ?`, old)
+	time.Sleep(50 * time.Millisecond)
+	lockedAt, err := Get(ctx, conn, func(s Scanner) (at time.Time, err error) {
+		err = s.Scan(&at)
+		return at, err
+	}, `SELECT locked_at FROM schema_migrations_lock WHERE id = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(lockedAt) > staleLock {
+		t.Errorf("expected the lock to be refreshed, locked at %v", lockedAt)
+	}
+}
+
+func TestLockError(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+	if _, err := Exec(ctx, conn, `CREATE TABLE schema_migrations_lock (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+
+	// errors other than a held lock aren't retried
+	start := time.Now()
+	_, err := lock(ctx)
+	if err == nil || !strings.Contains(err.Error(), "owner") {
+		t.Fatalf("expected the insert error, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("expected the error right away, took %v", time.Since(start))
+	}
+}
+
+func TestIsDuplicate(t *testing.T) {
+	testDB(t)
+	ctx := context.Background()
+	Exec(ctx, conn, `CREATE TABLE t (id INTEGER PRIMARY KEY, name TEXT UNIQUE)`)
+	Exec(ctx, conn, `INSERT INTO t (id, name) VALUES (1, 'a')`)
+
+	_, pkErr := Exec(ctx, conn, `INSERT INTO t (id, name) VALUES (1, 'b')`)
+	_, uniqueErr := Exec(ctx, conn, `INSERT INTO t (id, name) VALUES (2, 'a')`)
+	_, missingErr := Exec(ctx, conn, `INSERT INTO nope (id) VALUES (1)`)
+	for err, want := range map[error]bool{
+		pkErr:      true,
+		uniqueErr:  true,
+		missingErr: false,
+		errors.New(`pq: duplicate key value violates unique constraint "schema_migrations_lock_pkey"`): true,
+		errors.New("database is locked"): false,
+	} {
+		if got := isDuplicate(err); got != want {
+			t.Errorf("%v expected %t, got %t", err, want, got)
+		}
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	got := splitStatements("-- a comment; with a semicolon\nINSERT INTO t VALUES ('a;b', \"c;\");\n\n;SELECT 1")
+	want := []string{`INSERT INTO t VALUES ('a;b', "c;")`, "SELECT 1"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,7 @@
+CREATE TABLE kittns (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	name       TEXT NOT NULL,
+	breed      TEXT NOT NULL,
+	fluffiness INTEGER NOT NULL DEFAULT 0,
+	cuteness   INTEGER NOT NULL DEFAULT 0
+);
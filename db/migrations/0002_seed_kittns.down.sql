@@ -0,0 +1,2 @@
+-- the seeded kittns are the first rows of the table created by 0001
+DELETE FROM kittns WHERE id IN (1, 2);
@@ -0,0 +1,3 @@
+-- example kittns that match the api docs
+INSERT INTO kittns (name, breed, fluffiness, cuteness) VALUES ('Fluffums', 'calico', 6, 7);
+INSERT INTO kittns (name, breed, fluffiness, cuteness) VALUES ('Max', 'calico', 5, 10);
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// APIKeyUser maps an api key to the principal it identifies
+type APIKeyUser struct {
+	Key     string   `toml:"key"`
+	Subject string   `toml:"subject"`
+	Scopes  []string `toml:"scopes"`
+}
+
+// DefaultAPIKeyHeader is used when Options.APIKeyHeader is empty
+const DefaultAPIKeyHeader = "X-API-Key"
+
+type apiKeys struct {
+	header string
+	keys   []APIKeyUser
+}
+
+func newAPIKeys(header string, keys []APIKeyUser) *apiKeys {
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+	return &apiKeys{header: header, keys: keys}
+}
+
+// Authenticate checks the api key header against the configured keys
+func (a *apiKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(a.header)
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	// compare hashes so every comparison takes the same time
+	given := sha256.Sum256([]byte(key))
+	var match *APIKeyUser
+	for i, k := range a.keys {
+		h := sha256.Sum256([]byte(k.Key))
+		if subtle.ConstantTimeCompare(given[:], h[:]) == 1 {
+			match = &a.keys[i]
+		}
+	}
+	if match == nil {
+		return nil, errors.New("invalid api key")
+	}
+
+	return &Principal{Subject: match.Subject, Scopes: match.Scopes}, nil
+}
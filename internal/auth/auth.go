@@ -0,0 +1,166 @@
+// Package auth authenticates api requests with api keys, http basic or jwt bearer tokens.
+// Endpoints select the methods they accept, the first method that finds valid
+// credentials provides the Principal for the request
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Method is an authentication method that can be required by an endpoint
+type Method string
+
+type Methods []Method
+
+const (
+	APIKey Method = "api_key"
+	Basic  Method = "basic"
+	JWT    Method = "jwt"
+)
+
+// ErrNoCredentials is returned by a validator when the request
+// does not have credentials for that method
+var ErrNoCredentials = errors.New("no credentials")
+
+// Options configures the authentication methods,
+// a method is only enabled when it has been configured
+type Options struct {
+	APIKeyHeader string       `toml:"api_key_header" json:"api_key_header" comment:"header for the api key (default X-API-Key)"`
+	APIKeys      []APIKeyUser `toml:"api_keys" json:"-" comment:"api keys and the principal they identify"`
+	BasicUsers   []BasicUser  `toml:"basic_users" json:"-" comment:"http basic users with bcrypt password hashes"`
+	JWT          *JWTOptions  `toml:"jwt" json:"jwt"`
+}
+
+// Principal is the authenticated identity of the request
+type Principal struct {
+	Subject string         `json:"subject"`
+	Method  Method         `json:"method"`
+	Scopes  []string       `json:"scopes,omitempty"`
+	Claims  map[string]any `json:"-"`
+}
+
+// Missing returns the scopes the principal doesn't have
+func (p *Principal) Missing(scopes []string) (missing []string) {
+	for _, s := range scopes {
+		found := false
+		for _, ps := range p.Scopes {
+			if ps == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// Validator authenticates a request for a single method
+type Validator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+type ctxPrincipalKey int
+
+const principalKey ctxPrincipalKey = 0
+
+var validators = make(map[Method]Validator)
+
+// apiKeyHeader is the configured api key header
+var apiKeyHeader = DefaultAPIKeyHeader
+
+// Init sets up the validators for the configured methods
+func Init(o *Options) error {
+	validators = make(map[Method]Validator)
+	apiKeyHeader = DefaultAPIKeyHeader
+	if o == nil {
+		return nil
+	}
+	if o.APIKeyHeader != "" {
+		apiKeyHeader = o.APIKeyHeader
+	}
+
+	if len(o.APIKeys) > 0 {
+		validators[APIKey] = newAPIKeys(o.APIKeyHeader, o.APIKeys)
+	}
+	if len(o.BasicUsers) > 0 {
+		validators[Basic] = basicUsers(o.BasicUsers)
+	}
+	if o.JWT != nil && (o.JWT.Secret != "" || o.JWT.JWKSFile != "") {
+		v, err := newJWT(o.JWT)
+		if err != nil {
+			return fmt.Errorf("jwt auth setup %w", err)
+		}
+		validators[JWT] = v
+	}
+
+	return nil
+}
+
+// APIKeyHeader returns the header used for api keys
+func APIKeyHeader() string {
+	return apiKeyHeader
+}
+
+// Register adds or replaces the validator for a method
+func Register(m Method, v Validator) {
+	validators[m] = v
+}
+
+// Enabled returns true when the method has a validator
+func Enabled(m Method) bool {
+	_, found := validators[m]
+	return found
+}
+
+// Authenticate tries each of the methods in order and returns the first
+// valid principal, ErrNoCredentials is returned when the request had no credentials
+// for any of the methods, otherwise the last validation error is returned
+func Authenticate(r *http.Request, methods Methods) (*Principal, error) {
+	err := ErrNoCredentials
+	for _, m := range methods {
+		v, found := validators[m]
+		if !found {
+			continue
+		}
+		p, vErr := v.Authenticate(r)
+		if vErr == nil {
+			p.Method = m
+			return p, nil
+		}
+		if !errors.Is(vErr, ErrNoCredentials) {
+			err = fmt.Errorf("%s %w", m, vErr)
+		}
+	}
+	return nil, err
+}
+
+// Challenge returns the WWW-Authenticate header value for the methods
+func Challenge(methods Methods) string {
+	var c []string
+	for _, m := range methods {
+		switch m {
+		case Basic:
+			c = append(c, `Basic realm="api"`)
+		case JWT:
+			c = append(c, `Bearer realm="api"`)
+		}
+	}
+	return strings.Join(c, ", ")
+}
+
+// WithPrincipal adds the principal to the context
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// FromContext returns the authenticated principal for the request
+func FromContext(ctx context.Context) (p *Principal, found bool) {
+	p, found = ctx.Value(principalKey).(*Principal)
+	return p, found
+}
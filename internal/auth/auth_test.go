@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuthenticate(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := basicUsers{{Username: "alice", Password: string(hash), Scopes: []string{"read"}}}
+
+	auth := func(user, pw string) (*Principal, error, time.Duration) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth(user, pw)
+		start := time.Now()
+		p, err := users.Authenticate(r)
+		return p, err, time.Since(start)
+	}
+
+	p, err, _ := auth("alice", "pw")
+	if err != nil || p.Subject != "alice" || len(p.Scopes) != 1 {
+		t.Fatalf("expected alice, got %+v %v", p, err)
+	}
+
+	_, wrongErr, wrong := auth("alice", "nope")
+	_, unknownErr, unknown := auth("mallory", "nope")
+	if wrongErr == nil || unknownErr == nil || wrongErr.Error() != unknownErr.Error() {
+		t.Fatalf("expected the same error for a wrong password and unknown user, got %v and %v", wrongErr, unknownErr)
+	}
+	if strings.Contains(unknownErr.Error(), "mallory") {
+		t.Errorf("the username shouldn't be in the error %v", unknownErr)
+	}
+	// an unknown user still does the bcrypt work
+	if unknown < wrong/4 {
+		t.Errorf("expected the unknown user to take about as long as a wrong password, got %v and %v", unknown, wrong)
+	}
+
+	if _, err := users.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil)); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected no credentials, got %v", err)
+	}
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	keys := newAPIKeys("", []APIKeyUser{{Key: "k1", Subject: "reporting"}, {Key: "k2", Subject: "billing"}})
+
+	cases := map[string]struct {
+		key     string
+		subject string
+		err     error
+	}{
+		"first key":  {key: "k1", subject: "reporting"},
+		"second key": {key: "k2", subject: "billing"},
+		"no key":     {err: ErrNoCredentials},
+		"bad key":    {key: "k3", err: errors.New("invalid api key")},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if c.key != "" {
+				r.Header.Set(DefaultAPIKeyHeader, c.key)
+			}
+			p, err := keys.Authenticate(r)
+			if c.err != nil {
+				if err == nil || err.Error() != c.err.Error() {
+					t.Fatalf("expected %v, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil || p.Subject != c.subject {
+				t.Fatalf("expected %s, got %+v %v", c.subject, p, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	defer Init(nil)
+	if err := Init(&Options{APIKeys: []APIKeyUser{{Key: "k1", Subject: "reporting"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := Authenticate(r, Methods{Basic, APIKey}); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected no credentials, got %v", err)
+	}
+
+	r.Header.Set(DefaultAPIKeyHeader, "k1")
+	p, err := Authenticate(r, Methods{Basic, APIKey})
+	if err != nil || p.Method != APIKey || p.Subject != "reporting" {
+		t.Fatalf("expected the api key principal, got %+v %v", p, err)
+	}
+
+	r.Header.Set(DefaultAPIKeyHeader, "bad")
+	if _, err := Authenticate(r, Methods{APIKey}); err == nil || errors.Is(err, ErrNoCredentials) || !strings.HasPrefix(err.Error(), "api_key") {
+		t.Errorf("expected the api key error, got %v", err)
+	}
+}
+
+func TestInitReset(t *testing.T) {
+	defer Init(nil)
+	if err := Init(&Options{APIKeyHeader: "X-Key", APIKeys: []APIKeyUser{{Key: "k1", Subject: "reporting"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if APIKeyHeader() != "X-Key" || !Enabled(APIKey) {
+		t.Fatalf("expected the api key header X-Key, got %s", APIKeyHeader())
+	}
+
+	// a reloaded config doesn't keep the old header or validators
+	if err := Init(&Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if APIKeyHeader() != DefaultAPIKeyHeader || Enabled(APIKey) {
+		t.Errorf("expected the default header and no api keys, got %s %t", APIKeyHeader(), Enabled(APIKey))
+	}
+}
+
+func TestMissing(t *testing.T) {
+	p := &Principal{Scopes: []string{"read", "write"}}
+	if m := p.Missing([]string{"read", "admin"}); len(m) != 1 || m[0] != "admin" {
+		t.Errorf("expected admin to be missing, got %v", m)
+	}
+}
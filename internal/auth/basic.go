@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicUser is an http basic user, the password is a bcrypt hash
+type BasicUser struct {
+	Username string   `toml:"username"`
+	Password string   `toml:"password" comment:"bcrypt hash of the password"`
+	Scopes   []string `toml:"scopes"`
+}
+
+type basicUsers []BasicUser
+
+// dummyHash is compared for unknown users so a miss takes as long as a wrong password
+const dummyHash = "$2a$10$z/WdVnDgsVZiPwp1yBoy3.eyX4YwHhLfNZLL4Xs3Twr7ABeVhX0CG"
+
+// errInvalidCredentials doesn't say which of the username or password was wrong
+var errInvalidCredentials = errors.New("invalid username or password")
+
+// Authenticate checks the basic auth username and password
+func (b basicUsers) Authenticate(r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	for _, u := range b {
+		if u.Username != username {
+			continue
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)); err != nil {
+			return nil, errInvalidCredentials
+		}
+		return &Principal{Subject: u.Username, Scopes: u.Scopes}, nil
+	}
+
+	bcrypt.CompareHashAndPassword([]byte(dummyHash), []byte(password))
+	return nil, errInvalidCredentials
+}
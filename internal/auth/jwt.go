@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTOptions configures bearer token validation, HS256 tokens are
+// checked with the Secret and RS256 tokens with the keys in the JWKSFile
+type JWTOptions struct {
+	Secret     string `toml:"secret" json:"-" comment:"shared secret for HS256 tokens"`
+	JWKSFile   string `toml:"jwks_file" json:"jwks_file" comment:"local JWKS file with the RS256 public keys"`
+	Issuer     string `toml:"issuer" json:"issuer" comment:"required iss claim (optional)"`
+	Audience   string `toml:"audience" json:"audience" comment:"required aud claim (optional)"`
+	ScopeClaim string `toml:"scope_claim" json:"scope_claim" comment:"claim with the token scopes (default scope)"`
+}
+
+type jwtValidator struct {
+	opts    *JWTOptions
+	keys    map[string]*rsa.PublicKey // RS256 keys by kid
+	methods []string
+	parser  *jwt.Parser
+}
+
+// jwks is a JSON Web Key Set, only RSA keys are used
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func newJWT(o *JWTOptions) (*jwtValidator, error) {
+	if o.ScopeClaim == "" {
+		o.ScopeClaim = "scope"
+	}
+	v := &jwtValidator{opts: o, keys: make(map[string]*rsa.PublicKey)}
+
+	if o.Secret != "" {
+		v.methods = append(v.methods, jwt.SigningMethodHS256.Alg())
+	}
+	if o.JWKSFile != "" {
+		if err := v.loadJWKS(o.JWKSFile); err != nil {
+			return nil, err
+		}
+		v.methods = append(v.methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	opts := []jwt.ParserOption{jwt.WithValidMethods(v.methods), jwt.WithExpirationRequired()}
+	if o.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(o.Issuer))
+	}
+	if o.Audience != "" {
+		opts = append(opts, jwt.WithAudience(o.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// loadJWKS reads the RSA public keys from the JWKS file
+func (v *jwtValidator) loadJWKS(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read jwks file %w", err)
+	}
+	set := jwks{}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return fmt.Errorf("could not parse jwks file %w", err)
+	}
+
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return fmt.Errorf("invalid modulus for key %s %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return fmt.Errorf("invalid exponent for key %s %w", k.Kid, err)
+		}
+		v.keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(v.keys) == 0 {
+		return errors.New("no RSA signing keys found in the jwks file")
+	}
+
+	return nil
+}
+
+// keyFunc returns the key used to verify the token's signature
+func (v *jwtValidator) keyFunc(t *jwt.Token) (any, error) {
+	switch t.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return []byte(v.opts.Secret), nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := t.Header["kid"].(string)
+		if k, found := v.keys[kid]; found {
+			return k, nil
+		}
+		if kid == "" && len(v.keys) == 1 {
+			for _, k := range v.keys {
+				return k, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+}
+
+// Authenticate validates the bearer token in the Authorization header
+func (v *jwtValidator) Authenticate(r *http.Request) (*Principal, error) {
+	h := r.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+		return nil, ErrNoCredentials
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(strings.TrimSpace(h[7:]), claims, v.keyFunc); err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims.GetSubject()
+	return &Principal{Subject: sub, Scopes: scopes(claims[v.opts.ScopeClaim]), Claims: claims}, nil
+}
+
+// scopes reads a space delimited scope string or an array of scopes
+func scopes(v any) []string {
+	switch s := v.(type) {
+	case string:
+		return strings.Fields(s)
+	case []any:
+		list := make([]string, 0, len(s))
+		for _, i := range s {
+			if str, ok := i.(string); ok {
+				list = append(list, str)
+			}
+		}
+		return list
+	}
+	return nil
+}
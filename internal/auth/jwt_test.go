@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func bearer(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func sign(t *testing.T, m jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(m, claims)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWTSecret(t *testing.T) {
+	v, err := newJWT(&JWTOptions{Secret: "s3cret", Issuer: "me", Audience: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	cases := map[string]struct {
+		token string
+		valid bool
+	}{
+		"valid":       {token: sign(t, jwt.SigningMethodHS256, []byte("s3cret"), "", jwt.MapClaims{"sub": "bob", "iss": "me", "aud": "api", "exp": exp, "scope": "read write"}), valid: true},
+		"wrong key":   {token: sign(t, jwt.SigningMethodHS256, []byte("other"), "", jwt.MapClaims{"sub": "bob", "iss": "me", "aud": "api", "exp": exp})},
+		"expired":     {token: sign(t, jwt.SigningMethodHS256, []byte("s3cret"), "", jwt.MapClaims{"sub": "bob", "iss": "me", "aud": "api", "exp": time.Now().Add(-time.Hour).Unix()})},
+		"no exp":      {token: sign(t, jwt.SigningMethodHS256, []byte("s3cret"), "", jwt.MapClaims{"sub": "bob", "iss": "me", "aud": "api"})},
+		"wrong iss":   {token: sign(t, jwt.SigningMethodHS256, []byte("s3cret"), "", jwt.MapClaims{"sub": "bob", "iss": "you", "aud": "api", "exp": exp})},
+		"wrong aud":   {token: sign(t, jwt.SigningMethodHS256, []byte("s3cret"), "", jwt.MapClaims{"sub": "bob", "iss": "me", "aud": "web", "exp": exp})},
+		"none alg":    {token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", jwt.MapClaims{"sub": "bob", "iss": "me", "aud": "api", "exp": exp})},
+		"not a token": {token: "abc.def"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			p, err := v.Authenticate(bearer(c.token))
+			if !c.valid {
+				if err == nil {
+					t.Fatalf("expected an invalid token, got %+v", p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Subject != "bob" || len(p.Scopes) != 2 || p.Scopes[1] != "write" {
+				t.Errorf("unexpected principal %+v", p)
+			}
+		})
+	}
+
+	if _, err := v.Authenticate(httptest.NewRequest(http.MethodGet, "/", nil)); err != ErrNoCredentials {
+		t.Errorf("expected no credentials, got %v", err)
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := base64.RawURLEncoding.EncodeToString
+	set := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "k1", "use": "sig", "n": enc(key.N.Bytes()), "e": enc(big.NewInt(int64(key.E)).Bytes())},
+		{"kty": "EC", "kid": "ec"},
+	}}
+	b, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := newJWT(&JWTOptions{JWKSFile: path, ScopeClaim: "scp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.keys) != 1 {
+		t.Fatalf("expected only the RSA key, got %d keys", len(v.keys))
+	}
+	claims := jwt.MapClaims{"sub": "svc", "exp": time.Now().Add(time.Hour).Unix(), "scp": []any{"read"}}
+
+	// the kid selects the key, a single key is used when the token has no kid
+	for _, kid := range []string{"k1", ""} {
+		p, err := v.Authenticate(bearer(sign(t, jwt.SigningMethodRS256, key, kid, claims)))
+		if err != nil {
+			t.Fatalf("kid %q %v", kid, err)
+		}
+		if p.Subject != "svc" || len(p.Scopes) != 1 || p.Scopes[0] != "read" {
+			t.Errorf("unexpected principal %+v", p)
+		}
+	}
+
+	if _, err := v.Authenticate(bearer(sign(t, jwt.SigningMethodRS256, key, "k2", claims))); err == nil {
+		t.Error("expected an unknown kid to fail")
+	}
+	if _, err := v.Authenticate(bearer(sign(t, jwt.SigningMethodRS256, other, "k1", claims))); err == nil {
+		t.Error("expected a token signed by another key to fail")
+	}
+	// HS256 isn't allowed without a secret, the public key can't be used as an hmac key
+	if _, err := v.Authenticate(bearer(sign(t, jwt.SigningMethodHS256, []byte("x"), "k1", claims))); err == nil {
+		t.Error("expected HS256 to be rejected")
+	}
+}
+
+func TestJWKSErrors(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"missing":  "",
+		"invalid":  "{",
+		"no rsa":   `{"keys":[{"kty":"EC","kid":"a"}]}`,
+		"bad mod":  `{"keys":[{"kty":"RSA","kid":"a","n":"!!","e":"AQAB"}]}`,
+		"enc only": `{"keys":[{"kty":"RSA","kid":"a","use":"enc","n":"AQAB","e":"AQAB"}]}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if content != "" {
+			os.WriteFile(path, []byte(content), 0o600)
+		}
+		if _, err := newJWT(&JWTOptions{JWKSFile: path}); err == nil {
+			t.Errorf("%s expected an error", name)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	if s := scopes("a  b"); len(s) != 2 {
+		t.Errorf("expected 2 scopes, got %v", s)
+	}
+	if s := scopes([]any{"a", 1, "b"}); len(s) != 2 {
+		t.Errorf("expected the string scopes, got %v", s)
+	}
+	if s := scopes(nil); s != nil {
+		t.Errorf("expected no scopes, got %v", s)
+	}
+}
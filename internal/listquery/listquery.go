@@ -0,0 +1,492 @@
+// Package listquery parses the paging, sort and filter query params of list endpoints into a Query.
+// A Query is applied to in-memory slices with Paginate or to sql with its Where, OrderBy and Limits
+// clauses, the results are returned as a Page that adds the Link header to the response.
+//
+// Pages are selected by an offset or by a keyset cursor, a cursor has the sort values of the
+// first or last item of a page and selects the items before or after it, so the pages
+// don't shift when items are added or removed. Cursors need the Spec's Key
+package listquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rest-api/internal/logger"
+)
+
+// the paging and sort query params
+const (
+	LimitParam  = "limit"
+	OffsetParam = "offset"
+	CursorParam = "cursor"
+	SortParam   = "sort"
+)
+
+// Type is the value type of a field's filter values
+type Type uint
+
+const (
+	String Type = iota // default
+	Int
+	Float
+	Bool
+	Time // RFC3339 or 2006-01-02
+)
+
+// Op is a filter operator, a field is filtered with field[op]=value
+type Op string
+
+const (
+	Eq   Op = "eq" // field=value or field[eq]=value
+	Ne   Op = "ne"
+	Gt   Op = "gt"
+	Gte  Op = "gte"
+	Lt   Op = "lt"
+	Lte  Op = "lte"
+	In   Op = "in"   // one of the comma separated values
+	Like Op = "like" // contains the value (case insensitive), only for String fields
+)
+
+var opDesc = map[Op]string{
+	Eq:   "equal to",
+	Ne:   "not equal to",
+	Gt:   "greater than",
+	Gte:  "greater than or equal to",
+	Lt:   "less than",
+	Lte:  "less than or equal to",
+	In:   "one of the comma separated values",
+	Like: "contains the value",
+}
+
+// Field is a field of the listed items that can be filtered or sorted
+type Field struct {
+	Name        string // the query param name i.e., cute for cute[gte]=5
+	Column      string // the sql column and the json name of the item's struct field (default Name)
+	Type        Type   // the type filter values are parsed as
+	Ops         []Op   // the filter operators allowed, the field can't be filtered when empty
+	Sort        bool   // the field can be used in the sort param
+	Description string // (api docs) the field's description
+}
+
+// Spec is the fields and page limits of a list endpoint
+type Spec struct {
+	Fields       []Field
+	DefaultLimit int    // the page size when the limit isn't given (default 20)
+	MaxLimit     int    // the largest limit allowed (default 100)
+	DefaultSort  string // the sort used when it isn't given i.e., -name
+	Key          string // a unique sortable field added to the end of each sort so pages are stable i.e., id, it's needed for cursors
+}
+
+// Sort orders the items by a field, sort=-name,id is name descending then id
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Filter is a field[op]=value query param, the Value has the field's type
+// (string, int64, float64, bool or time.Time) and is a []any for In
+type Filter struct {
+	Field string
+	Op    Op
+	Value any
+}
+
+// Query is the parsed list params for a request
+type Query struct {
+	Limit   int
+	Offset  int
+	Cursor  bool // the page is selected by a cursor instead of the offset, the page links use cursors
+	Sort    []Sort
+	Filters []Filter
+
+	seek   []any // the cursor's sort values
+	before bool  // the page is the items before the seek values
+	spec   *Spec
+}
+
+// Param describes one of the spec's query params for the api docs
+type Param struct {
+	Name        string
+	Description string
+	Type        Type
+	Default     string
+}
+
+// Limits returns the default and max limit
+func (s *Spec) Limits() (def, max int) {
+	def, max = s.DefaultLimit, s.MaxLimit
+	if max <= 0 {
+		max = 100
+	}
+	if def <= 0 {
+		def = min(20, max)
+	}
+	return def, max
+}
+
+// field returns the field with the query param name
+func (s *Spec) field(name string) (Field, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// column is the sql column or json name of the field
+func (s *Spec) column(name string) string {
+	if s == nil {
+		return name
+	}
+	if f, found := s.field(name); found && f.Column != "" {
+		return f.Column
+	}
+	return name
+}
+
+func (s *Spec) sortable() (names []string) {
+	for _, f := range s.Fields {
+		if f.Sort {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// allows returns true when the field can be filtered with the op
+func (f Field) allows(op Op) bool {
+	for _, o := range f.Ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterName is the query param name for the field and op, Eq uses the field name
+func FilterName(field string, op Op) string {
+	if op == Eq {
+		return field
+	}
+	return field + "[" + string(op) + "]"
+}
+
+// Validate checks the fields and the default sort
+func (s *Spec) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if s.DefaultLimit > 0 && s.MaxLimit > 0 && s.DefaultLimit > s.MaxLimit {
+		return fmt.Errorf("list default limit %d is more than the max limit %d", s.DefaultLimit, s.MaxLimit)
+	}
+
+	names := make(map[string]bool)
+	for _, f := range s.Fields {
+		switch f.Name {
+		case "", LimitParam, OffsetParam, CursorParam, SortParam:
+			return fmt.Errorf("invalid list field name %q", f.Name)
+		}
+		if strings.ContainsAny(f.Name, "[] ,") {
+			return fmt.Errorf("list field name %q can't have brackets, commas or spaces", f.Name)
+		}
+		if names[f.Name] {
+			return fmt.Errorf("duplicate list field %q", f.Name)
+		}
+		names[f.Name] = true
+		for _, op := range f.Ops {
+			if _, found := opDesc[op]; !found {
+				return fmt.Errorf("list field %s has an unknown operator %q", f.Name, op)
+			}
+			if op == Like && f.Type != String {
+				return fmt.Errorf("list field %s needs the String type for like", f.Name)
+			}
+		}
+	}
+
+	if s.Key != "" {
+		if f, found := s.field(s.Key); !found || !f.Sort {
+			return fmt.Errorf("list key %q needs to be a sortable field", s.Key)
+		}
+	}
+	if _, err := s.parseSort(s.DefaultSort); err != nil {
+		return fmt.Errorf("invalid list default sort %w", err)
+	}
+	return nil
+}
+
+// Params are the paging, sort and filter query params, each filter operator is its own param
+func (s *Spec) Params() []Param {
+	def, max := s.Limits()
+	ps := []Param{
+		{Name: LimitParam, Type: Int, Default: strconv.Itoa(def), Description: fmt.Sprintf("the number of items in the page (max %d)", max)},
+		{Name: OffsetParam, Type: Int, Description: "the number of items to skip"},
+		{Name: CursorParam, Description: "the next_cursor or prev_cursor of a page, it can't be used with offset or a different sort"},
+		{Name: SortParam, Default: s.DefaultSort, Description: "comma separated fields to sort by, a field prefixed with - is sorted descending. Sortable fields: " + strings.Join(s.sortable(), ", ")},
+	}
+
+	for _, f := range s.Fields {
+		for _, op := range f.Ops {
+			desc := "filter by " + f.Name
+			if f.Description != "" {
+				desc = f.Description
+			}
+			p := Param{Name: FilterName(f.Name, op), Type: f.Type, Description: desc + ", " + opDesc[op]}
+			if op == In {
+				p.Type = String
+			}
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// Parse reads the list params from the query values, params that aren't list params are ignored.
+// All of the invalid params are returned as field errors
+func (s *Spec) Parse(values url.Values) (Query, []logger.FieldError) {
+	q := Query{spec: s}
+	var errs []logger.FieldError
+	invalid := func(field, reason string) {
+		errs = append(errs, logger.FieldError{Field: field, Reason: reason})
+	}
+
+	def, max := s.Limits()
+	q.Limit = def
+	if v := values.Get(LimitParam); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > max {
+			invalid(LimitParam, fmt.Sprintf("must be between 1 and %d", max))
+		} else {
+			q.Limit = n
+		}
+	}
+
+	sorts := values.Get(SortParam)
+	if sorts == "" {
+		sorts = s.DefaultSort
+	}
+	var err error
+	if q.Sort, err = s.parseSort(sorts); err != nil {
+		invalid(SortParam, err.Error())
+	}
+
+	cursor, offset := values.Get(CursorParam), values.Get(OffsetParam)
+	switch {
+	case cursor != "" && offset != "":
+		invalid(CursorParam, "can't be used with offset")
+	case cursor != "" && s.Key == "":
+		invalid(CursorParam, "isn't supported, use offset")
+	case cursor != "" && err == nil:
+		if err := q.decodeCursor(cursor); err != nil {
+			invalid(CursorParam, err.Error())
+		}
+	case offset != "":
+		n, err := strconv.Atoi(offset)
+		if err != nil || n < 0 {
+			invalid(OffsetParam, "must be 0 or more")
+		} else {
+			q.Offset = n
+		}
+	}
+
+	// the keys are sorted so the filters (and the sql) are in the same order for each request
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name, op := key, Eq
+		if i := strings.IndexByte(key, '['); i > 0 && strings.HasSuffix(key, "]") {
+			name, op = key[:i], Op(key[i+1:len(key)-1])
+		}
+		f, found := s.field(name)
+		if !found {
+			continue // not a list param
+		}
+		if !f.allows(op) {
+			invalid(key, fmt.Sprintf("can't be filtered with %s", op))
+			continue
+		}
+
+		for _, v := range values[key] {
+			if op != In {
+				val, err := f.parse(v)
+				if err != nil {
+					invalid(key, err.Error())
+					continue
+				}
+				q.Filters = append(q.Filters, Filter{Field: f.Name, Op: op, Value: val})
+				continue
+			}
+
+			var vals []any
+			for _, s := range strings.Split(v, ",") {
+				val, err := f.parse(strings.TrimSpace(s))
+				if err != nil {
+					invalid(key, err.Error())
+					continue
+				}
+				vals = append(vals, val)
+			}
+			if len(vals) > 0 {
+				q.Filters = append(q.Filters, Filter{Field: f.Name, Op: In, Value: vals})
+			}
+		}
+	}
+
+	return q, errs
+}
+
+// parseSort reads the comma separated sort fields, the Key is added when it isn't in the sort
+func (s *Spec) parseSort(sorts string) ([]Sort, error) {
+	var list []Sort
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(sorts, ",") {
+		name = strings.TrimSpace(name) // a + prefix is decoded as a space
+		if name == "" {
+			continue
+		}
+		st := Sort{Field: strings.TrimPrefix(name, "-"), Desc: strings.HasPrefix(name, "-")}
+		if f, found := s.field(st.Field); !found || !f.Sort {
+			return nil, fmt.Errorf("can't sort by %s, use %s", st.Field, strings.Join(s.sortable(), ", "))
+		}
+		if seen[st.Field] {
+			continue
+		}
+		seen[st.Field] = true
+		list = append(list, st)
+	}
+
+	if s.Key != "" && !seen[s.Key] {
+		list = append(list, Sort{Field: s.Key})
+	}
+	return list, nil
+}
+
+// parse converts the filter value to the field's type
+func (f Field) parse(s string) (any, error) {
+	switch f.Type {
+	case Int:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.New("must be an integer")
+		}
+		return n, nil
+	case Float:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.New("must be a number")
+		}
+		return n, nil
+	case Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		return b, nil
+	case Time:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", s)
+		}
+		if err != nil {
+			return nil, errors.New("must be an RFC3339 time or a 2006-01-02 date")
+		}
+		return t, nil
+	}
+	return s, nil
+}
+
+// cursor is the json in a base64 cursor param
+type cursor struct {
+	Sort   string    `json:"s"`           // the sort the values are for
+	Values []*string `json:"v"`           // the item's sort values, nil for a null value
+	Before bool      `json:"b,omitempty"` // the page is before the item
+}
+
+// sortString is the sort param for the query's sort
+func (q Query) sortString() string {
+	names := make([]string, len(q.Sort))
+	for i, s := range q.Sort {
+		names[i] = s.Field
+		if s.Desc {
+			names[i] = "-" + s.Field
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// encodeCursor returns the opaque cursor for the page before or after the item's sort values
+func (q Query) encodeCursor(values []any, before bool) string {
+	c := cursor{Sort: q.sortString(), Values: make([]*string, len(values)), Before: before}
+	for i, v := range values {
+		if v != nil {
+			s := format(v)
+			c.Values[i] = &s
+		}
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor sets the seek values of the cursor, the query's sort is parsed first
+// so a cursor from a different sort is rejected
+func (q *Query) decodeCursor(s string) error {
+	invalid := errors.New("is invalid")
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return invalid
+	}
+	c := cursor{}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return invalid
+	}
+	if c.Sort != q.sortString() {
+		return errors.New("is for a different sort")
+	}
+	q.Cursor, q.before = true, c.Before
+	if len(c.Values) == 0 {
+		return nil // the first page or the last page before the end
+	}
+	if len(c.Values) != len(q.Sort) {
+		return invalid
+	}
+
+	q.seek = make([]any, len(c.Values))
+	for i, v := range c.Values {
+		if v == nil {
+			continue
+		}
+		f, _ := q.spec.field(q.Sort[i].Field)
+		if q.seek[i], err = f.parse(*v); err != nil {
+			return invalid
+		}
+	}
+	return nil
+}
+
+// format writes the value so it's read back by the field's parse
+func format(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,149 @@
+package listquery
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testSpec = &Spec{
+	Fields: []Field{
+		{Name: "id", Type: Int, Sort: true},
+		{Name: "name", Ops: []Op{Eq, Like}, Sort: true},
+		{Name: "breed", Ops: []Op{Eq, In}, Sort: true},
+		{Name: "cute", Column: "cuteness", Type: Int, Ops: []Op{Eq, Gte, Lte}, Sort: true},
+		{Name: "born", Type: Time, Ops: []Op{Gt}},
+		{Name: "indoor", Type: Bool, Ops: []Op{Eq}},
+	},
+	DefaultLimit: 3,
+	MaxLimit:     10,
+	DefaultSort:  "id",
+	Key:          "id",
+}
+
+func TestSpecValidate(t *testing.T) {
+	if err := testSpec.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]*Spec{
+		"limits":       {DefaultLimit: 20, MaxLimit: 10},
+		"reserved":     {Fields: []Field{{Name: "limit"}}},
+		"brackets":     {Fields: []Field{{Name: "a[b]"}}},
+		"duplicate":    {Fields: []Field{{Name: "a"}, {Name: "a"}}},
+		"unknown op":   {Fields: []Field{{Name: "a", Ops: []Op{"between"}}}},
+		"like int":     {Fields: []Field{{Name: "a", Type: Int, Ops: []Op{Like}}}},
+		"key sortable": {Fields: []Field{{Name: "id"}}, Key: "id"},
+		"default sort": {Fields: []Field{{Name: "id"}}, DefaultSort: "id"},
+	}
+	for name, s := range cases {
+		if err := s.Validate(); err == nil {
+			t.Errorf("%s expected an error", name)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	v, _ := url.ParseQuery("limit=5&offset=10&sort=-cute,name&breed[in]=calico,tabby&cute[gte]=5&name[like]=ma&born[gt]=2024-01-02&indoor=true&other=1")
+	q, errs := testSpec.Parse(v)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if q.Limit != 5 || q.Offset != 10 || q.Cursor {
+		t.Errorf("unexpected paging %+v", q)
+	}
+	wantSort := []Sort{{Field: "cute", Desc: true}, {Field: "name"}, {Field: "id"}}
+	if !reflect.DeepEqual(q.Sort, wantSort) {
+		t.Errorf("expected the key to be added to the sort %v, got %v", wantSort, q.Sort)
+	}
+	wantFilters := []Filter{
+		{Field: "born", Op: Gt, Value: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Field: "breed", Op: In, Value: []any{"calico", "tabby"}},
+		{Field: "cute", Op: Gte, Value: int64(5)},
+		{Field: "indoor", Op: Eq, Value: true},
+		{Field: "name", Op: Like, Value: "ma"},
+	}
+	if !reflect.DeepEqual(q.Filters, wantFilters) {
+		t.Errorf("expected the filters in key order %v, got %v", wantFilters, q.Filters)
+	}
+
+	q, _ = testSpec.Parse(url.Values{})
+	if q.Limit != 3 || len(q.Sort) != 1 || q.Sort[0].Field != "id" {
+		t.Errorf("expected the defaults, got %+v", q)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"limit=0":               "limit",
+		"limit=11":              "limit",
+		"offset=-1":             "offset",
+		"offset=1&cursor=abc":   "cursor",
+		"cursor=!!":             "cursor",
+		"cursor=e30":            "cursor", // {}
+		"sort=fluffy":           "sort",
+		"name[gt]=a":            "name[gt]",
+		"cute=soft":             "cute",
+		"cute[lte]=1.5":         "cute[lte]",
+		"born[gt]=yesterday":    "born[gt]",
+		"indoor=maybe":          "indoor",
+		"breed[in]=a&cute[in]=": "cute[in]",
+	}
+	for query, field := range cases {
+		v, _ := url.ParseQuery(query)
+		_, errs := testSpec.Parse(v)
+		if len(errs) != 1 || errs[0].Field != field {
+			t.Errorf("%s expected an error for %s, got %v", query, field, errs)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	q, _ := testSpec.Parse(url.Values{"sort": {"-cute,name"}})
+	born := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	s := &Spec{Fields: []Field{{Name: "born", Type: Time, Sort: true}, {Name: "id", Type: Int, Sort: true}, {Name: "w", Type: Float, Sort: true}}, Key: "id"}
+	tq, _ := s.Parse(url.Values{"sort": {"born,-w"}})
+
+	c := tq.encodeCursor([]any{born, 1.5, int64(7)}, true)
+	got, errs := s.Parse(url.Values{"sort": {"born,-w"}, "cursor": {c}})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if !got.Cursor || !got.before || !reflect.DeepEqual(got.seek, []any{born, 1.5, int64(7)}) {
+		t.Errorf("expected the cursor values, got %+v", got)
+	}
+
+	// the cursor is for the sort it was made with
+	_, errs = testSpec.Parse(url.Values{"cursor": {q.encodeCursor([]any{int64(5), "max", int64(1)}, false)}})
+	if len(errs) != 1 || errs[0].Reason != "is for a different sort" {
+		t.Errorf("expected a sort error, got %v", errs)
+	}
+
+	// a cursor without values is the first or last page
+	got, errs = testSpec.Parse(url.Values{"cursor": {q.encodeCursor(nil, true)}, "sort": {"-cute,name"}})
+	if len(errs) > 0 || !got.Cursor || !got.before || got.seek != nil {
+		t.Errorf("expected the last page, got %+v %v", got, errs)
+	}
+
+	noKey := &Spec{Fields: []Field{{Name: "id", Type: Int, Sort: true}}}
+	if _, errs := noKey.Parse(url.Values{"cursor": {c}}); len(errs) != 1 || errs[0].Field != CursorParam {
+		t.Errorf("expected cursors to need the key, got %v", errs)
+	}
+}
+
+func TestParams(t *testing.T) {
+	names := make(map[string]Type)
+	for _, p := range testSpec.Params() {
+		names[p.Name] = p.Type
+	}
+	for name, typ := range map[string]Type{"limit": Int, "offset": Int, "cursor": String, "sort": String, "name[like]": String, "breed[in]": String, "cute[gte]": Int, "cute": Int, "born[gt]": Time} {
+		if got, found := names[name]; !found || got != typ {
+			t.Errorf("expected the %s param with type %d, got %v %d", name, typ, found, got)
+		}
+	}
+	if _, found := names["id"]; found {
+		t.Error("id can't be filtered")
+	}
+}
@@ -0,0 +1,242 @@
+package listquery
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rest-api/internal/openapi"
+)
+
+// Paginate filters, sorts and pages the items with the query, the fields are matched to the
+// items' struct fields (or map keys) by their json names. The items slice isn't modified.
+// A cursor page is selected the same way as the query's SQL
+func Paginate[T any](q Query, items []T) Page[T] {
+	matched := make([]T, 0, len(items))
+	for _, it := range items {
+		if q.match(reflect.ValueOf(it)) {
+			matched = append(matched, it)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return q.less(reflect.ValueOf(matched[i]), reflect.ValueOf(matched[j]))
+	})
+
+	total := len(matched)
+	if q.Cursor {
+		start := sort.Search(total, func(i int) bool {
+			return q.after(reflect.ValueOf(matched[i]))
+		})
+		return NewPage(q, matched[start:min(start+q.Limit+1, total)], total)
+	}
+	start := min(q.Offset, total)
+	end := min(start+q.Limit, total)
+	return NewPage(q, matched[start:end], total)
+}
+
+// match returns true when the item passes all of the filters
+func (q Query) match(v reflect.Value) bool {
+	for _, f := range q.Filters {
+		val, found := fieldValue(v, q.spec.column(f.Field))
+		if !found {
+			return false
+		}
+
+		switch f.Op {
+		case In:
+			in := false
+			for _, want := range f.Value.([]any) {
+				if c, ok := compare(val, want); ok && c == 0 {
+					in = true
+					break
+				}
+			}
+			if !in {
+				return false
+			}
+		case Like:
+			if !strings.Contains(strings.ToLower(fmt.Sprint(val)), strings.ToLower(f.Value.(string))) {
+				return false
+			}
+		default:
+			c, ok := compare(val, f.Value)
+			if !ok || !matches(f.Op, c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matches checks the comparison result against the operator
+func matches(op Op, c int) bool {
+	switch op {
+	case Eq:
+		return c == 0
+	case Ne:
+		return c != 0
+	case Gt:
+		return c > 0
+	case Gte:
+		return c >= 0
+	case Lt:
+		return c < 0
+	case Lte:
+		return c <= 0
+	}
+	return false
+}
+
+// less compares the items by each sort field in turn, the order is reversed for the page before a cursor
+func (q Query) less(a, b reflect.Value) bool {
+	for _, s := range q.Sort {
+		col := q.spec.column(s.Field)
+		av, _ := fieldValue(a, col)
+		bv, _ := fieldValue(b, col)
+		c, ok := compare(av, bv)
+		if !ok || c == 0 {
+			continue
+		}
+		if s.Desc != q.before {
+			return c > 0
+		}
+		return c < 0
+	}
+	return false
+}
+
+// after returns true when the item is past the cursor's sort values in the query's order
+func (q Query) after(v reflect.Value) bool {
+	if len(q.seek) == 0 {
+		return true
+	}
+	for i, s := range q.Sort {
+		val, _ := fieldValue(v, q.spec.column(s.Field))
+		c, ok := compare(val, q.seek[i])
+		if !ok || c == 0 {
+			continue
+		}
+		if s.Desc != q.before {
+			return c < 0
+		}
+		return c > 0
+	}
+	return false
+}
+
+// fieldValue finds the struct field or map key with the json name,
+// embedded structs without a json name are searched as part of the parent
+func fieldValue(v reflect.Value, name string) (any, bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		mv := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		if !mv.IsValid() {
+			return nil, false
+		}
+		return normalize(mv), true
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			if sf.Anonymous && sf.Tag.Get("json") == "" {
+				if val, found := fieldValue(v.Field(i), name); found {
+					return val, true
+				}
+				continue
+			}
+			if n, _ := openapi.JSONName(sf); n == name {
+				return normalize(v.Field(i)), true
+			}
+		}
+	}
+	return nil, false
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// normalize converts the value to the types used by the filters
+// (string, int64, float64, bool or time.Time), nil pointers are nil
+func normalize(v reflect.Value) any {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// compare returns -1, 0 or 1 for a < b, a == b or a > b,
+// ok is false when the values can't be compared i.e., a nil value
+func compare(a, b any) (c int, ok bool) {
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return strings.Compare(a, b), ok
+	case bool:
+		b, ok := b.(bool)
+		if !ok || a == b {
+			return 0, ok
+		}
+		if b {
+			return -1, true
+		}
+		return 1, true
+	case time.Time:
+		b, ok := b.(time.Time)
+		return a.Compare(b), ok
+	case int64:
+		if b, ok := b.(int64); ok {
+			return cmp.Compare(a, b), true
+		}
+	}
+
+	af, aok := toFloat(a)
+	bf, bok := toFloat(b)
+	if !aok || !bok {
+		return 0, false
+	}
+	return cmp.Compare(af, bf), true
+}
+
+func toFloat(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,167 @@
+package listquery
+
+import (
+	"database/sql"
+	"net/url"
+	"reflect"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+type kitten struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Breed string `json:"breed"`
+	Cute  int    `json:"cuteness"`
+}
+
+var kittens = []kitten{
+	{1, "Max", "calico", 7}, {2, "Bella", "tabby", 9}, {3, "Luna", "calico", 7},
+	{4, "Tom", "siamese", 3}, {5, "Cleo", "calico", 9}, {6, "Milo", "tabby", 5},
+	{7, "Nala", "calico", 7},
+}
+
+func ids(items []kitten) (l []int) {
+	for _, k := range items {
+		l = append(l, k.ID)
+	}
+	return l
+}
+
+func TestPaginate(t *testing.T) {
+	cases := map[string]struct {
+		query string
+		ids   []int
+		total int
+	}{
+		"default":  {query: "", ids: []int{1, 2, 3}, total: 7},
+		"offset":   {query: "offset=6", ids: []int{7}, total: 7},
+		"past end": {query: "offset=9", ids: nil, total: 7},
+		"filter":   {query: "breed=calico&cute[gte]=7&sort=-id", ids: []int{7, 5, 3}, total: 4},
+		"in":       {query: "breed[in]=tabby,siamese&limit=10", ids: []int{2, 4, 6}, total: 3},
+		"like":     {query: "name[like]=L", ids: []int{2, 3, 5}, total: 5},
+		"sort":     {query: "sort=-cute,name", ids: []int{2, 5, 3}, total: 7},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			v, _ := url.ParseQuery(c.query)
+			q, errs := testSpec.Parse(v)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			p := Paginate(q, kittens)
+			if !reflect.DeepEqual(ids(p.Data), c.ids) || p.Total != c.total {
+				t.Errorf("expected %v of %d, got %v of %d", c.ids, c.total, ids(p.Data), p.Total)
+			}
+		})
+	}
+}
+
+// page lists the kittns for the params
+type page func(v url.Values) Page[kitten]
+
+func memoryPage(t *testing.T) page {
+	return func(v url.Values) Page[kitten] {
+		q, errs := testSpec.Parse(v)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		return Paginate(q, kittens)
+	}
+}
+
+func sqlPage(t *testing.T) page {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE kittns (id INTEGER PRIMARY KEY, name TEXT NOT NULL, breed TEXT NOT NULL, cuteness INTEGER NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range kittens {
+		db.Exec(`INSERT INTO kittns VALUES (?, ?, ?, ?)`, k.ID, k.Name, k.Breed, k.Cute)
+	}
+
+	return func(v url.Values) Page[kitten] {
+		q, errs := testSpec.Parse(v)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		where, args := q.Where()
+		var total int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM kittns`+where, args...).Scan(&total); err != nil {
+			t.Fatal(err)
+		}
+		query, args := q.SQL(`SELECT id, name, breed, cuteness FROM kittns`)
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			t.Fatal(query, err)
+		}
+		defer rows.Close()
+		var kl []kitten
+		for rows.Next() {
+			k := kitten{}
+			rows.Scan(&k.ID, &k.Name, &k.Breed, &k.Cute)
+			kl = append(kl, k)
+		}
+		return NewPage(q, kl, total)
+	}
+}
+
+// TestCursorPages walks forward and back with the cursors in memory and with sql
+func TestCursorPages(t *testing.T) {
+	for name, list := range map[string]page{"memory": memoryPage(t), "sql": sqlPage(t)} {
+		t.Run(name, func(t *testing.T) {
+			v := url.Values{"sort": {"-cute,name"}, "limit": {"2"}}
+			want := [][]int{{2, 5}, {3, 1}, {7, 6}, {4}}
+
+			p := list(v)
+			for i, w := range want {
+				if !reflect.DeepEqual(ids(p.Data), w) {
+					t.Fatalf("page %d expected %v, got %v", i, w, ids(p.Data))
+				}
+				if (i > 0) != (p.PrevCursor != "") || (i < len(want)-1) != (p.NextCursor != "") {
+					t.Fatalf("page %d has the wrong cursors %q %q", i, p.PrevCursor, p.NextCursor)
+				}
+				if p.NextCursor == "" {
+					break
+				}
+				v.Set(CursorParam, p.NextCursor)
+				p = list(v)
+			}
+
+			for i := len(want) - 2; i >= 0; i-- {
+				v.Set(CursorParam, p.PrevCursor)
+				p = list(v)
+				if !reflect.DeepEqual(ids(p.Data), want[i]) {
+					t.Fatalf("back to page %d expected %v, got %v", i, want[i], ids(p.Data))
+				}
+			}
+			if p.PrevCursor != "" {
+				t.Errorf("the first page shouldn't have a prev cursor")
+			}
+
+			// the last page is before the end
+			q, _ := testSpec.Parse(v)
+			v.Set(CursorParam, q.encodeCursor(nil, true))
+			if p = list(v); !reflect.DeepEqual(ids(p.Data), []int{6, 4}) || p.NextCursor != "" || p.PrevCursor == "" {
+				t.Errorf("expected the last page, got %v %q %q", ids(p.Data), p.PrevCursor, p.NextCursor)
+			}
+		})
+	}
+}
+
+// TestCursorInsert checks the next page doesn't repeat items when an item is added before the cursor
+func TestCursorInsert(t *testing.T) {
+	q, _ := testSpec.Parse(url.Values{"limit": {"3"}})
+	first := Paginate(q, kittens)
+
+	added := append([]kitten{{ID: 0, Name: "Kit", Breed: "calico", Cute: 1}}, kittens...)
+	q, _ = testSpec.Parse(url.Values{"limit": {"3"}, CursorParam: {first.NextCursor}})
+	if p := Paginate(q, added); !reflect.DeepEqual(ids(p.Data), []int{4, 5, 6}) || p.Total != 8 {
+		t.Errorf("expected the items after 3, got %v of %d", ids(p.Data), p.Total)
+	}
+}
@@ -0,0 +1,125 @@
+package listquery
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Page is the pagination envelope for a list response,
+// the Link header is added when it's written by a setup handler
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	Total      int    `json:"total"`
+	Limit      int    `json:"limit"`
+	Offset     int    `json:"offset"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+
+	query      Query
+	next, prev bool // there are items after or before the page
+}
+
+// NewPage returns the page of items for the query, total is the number of items that matched the filters.
+// The items are in the order of the query's SQL, a cursor page has the extra item selected by Limits
+// and the page before a cursor is reversed. The cursors have the sort values of the first and last
+// items and are only set when the Spec has a Key
+func NewPage[T any](q Query, items []T, total int) Page[T] {
+	p := Page[T]{Total: total, Limit: q.Limit, Offset: q.Offset, query: q}
+	p.next, p.prev = q.Offset+len(items) < total, q.Offset > 0
+	if q.Cursor {
+		more := len(items) > q.Limit
+		if more {
+			items = items[:q.Limit]
+		}
+		if q.before {
+			items = slices.Clone(items)
+			slices.Reverse(items)
+			p.next, p.prev = len(q.seek) > 0, more
+		} else {
+			p.next, p.prev = more, len(q.seek) > 0
+		}
+	}
+	if items == nil {
+		items = []T{}
+	}
+	p.Data = items
+
+	if len(items) > 0 && q.spec != nil && q.spec.Key != "" {
+		if p.next {
+			p.NextCursor = q.encodeCursor(q.values(items[len(items)-1]), false)
+		}
+		if p.prev {
+			p.PrevCursor = q.encodeCursor(q.values(items[0]), true)
+		}
+	}
+	return p
+}
+
+// values returns the item's sort values
+func (q Query) values(item any) []any {
+	vals := make([]any, len(q.Sort))
+	for i, s := range q.Sort {
+		vals[i], _ = fieldValue(reflect.ValueOf(item), q.spec.column(s.Field))
+	}
+	return vals
+}
+
+// Rows returns the page's items, they're the rows of a csv response
+func (p Page[T]) Rows() any {
+	return p.Data
+}
+
+// SetHeaders adds the Link header with the first, prev, next and last pages. The links keep the
+// request's other query params and use the page's cursors when the request had a cursor, otherwise an offset
+func (p Page[T]) SetHeaders(r *http.Request, h http.Header) {
+	var links []string
+	link := func(rel, param, value string) {
+		v := r.URL.Query()
+		v.Del(CursorParam)
+		v.Del(OffsetParam)
+		if value != "" {
+			v.Set(param, value)
+		}
+		u := r.URL.Path
+		if len(v) > 0 {
+			u += "?" + v.Encode()
+		}
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u, rel))
+	}
+	offset := func(n int) string {
+		if n > 0 {
+			return strconv.Itoa(n)
+		}
+		return ""
+	}
+
+	link("first", "", "")
+	if p.query.Cursor {
+		if p.PrevCursor != "" {
+			link("prev", CursorParam, p.PrevCursor)
+		}
+		if p.NextCursor != "" {
+			link("next", CursorParam, p.NextCursor)
+		}
+		if p.Total > 0 {
+			link("last", CursorParam, p.query.encodeCursor(nil, true)) // the page before the end
+		}
+		h.Set("Link", strings.Join(links, ", "))
+		return
+	}
+
+	if p.prev {
+		link("prev", OffsetParam, offset(max(p.Offset-p.Limit, 0)))
+	}
+	if p.next {
+		link("next", OffsetParam, offset(p.Offset+p.Limit))
+	}
+	if p.Limit > 0 && p.Total > 0 {
+		link("last", OffsetParam, offset((p.Total-1)/p.Limit*p.Limit))
+	}
+	h.Set("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,81 @@
+package listquery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNewPage(t *testing.T) {
+	q, _ := testSpec.Parse(url.Values{"offset": {"3"}})
+	p := NewPage(q, kittens[3:6], 7)
+	if p.Offset != 3 || p.Limit != 3 || p.Total != 7 || p.NextCursor == "" || p.PrevCursor == "" {
+		t.Errorf("unexpected page %+v", p)
+	}
+
+	p = NewPage[kitten](q, nil, 0)
+	if p.Data == nil || p.NextCursor != "" || p.PrevCursor != "" {
+		t.Errorf("expected an empty page, got %+v", p)
+	}
+
+	// without a key there are no cursors
+	noKey := &Spec{Fields: []Field{{Name: "id", Type: Int, Sort: true}}}
+	q, _ = noKey.Parse(url.Values{"limit": {"2"}, "offset": {"2"}})
+	if p := NewPage(q, kittens[2:4], 7); p.NextCursor != "" || p.PrevCursor != "" {
+		t.Errorf("expected no cursors, got %+v", p)
+	}
+}
+
+func links(h http.Header) map[string]string {
+	l := make(map[string]string)
+	for _, s := range strings.Split(h.Get("Link"), ", ") {
+		u, rel, _ := strings.Cut(s, "; ")
+		u, _ = url.PathUnescape(strings.Trim(u, "<>"))
+		l[strings.TrimSuffix(strings.TrimPrefix(rel, `rel="`), `"`)] = u
+	}
+	return l
+}
+
+func TestSetHeadersOffset(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/kittns?breed=calico&offset=3", nil)
+	q, _ := testSpec.Parse(r.URL.Query())
+	h := http.Header{}
+	NewPage(q, kittens[3:6], 7).SetHeaders(r, h)
+
+	want := map[string]string{
+		"first": "/v1/kittns?breed=calico",
+		"prev":  "/v1/kittns?breed=calico",
+		"next":  "/v1/kittns?breed=calico&offset=6",
+		"last":  "/v1/kittns?breed=calico&offset=6",
+	}
+	got := links(h)
+	for rel, u := range want {
+		if got[rel] != u {
+			t.Errorf("%s expected %s, got %s", rel, u, got[rel])
+		}
+	}
+}
+
+func TestSetHeadersCursor(t *testing.T) {
+	first, _ := testSpec.Parse(url.Values{})
+	c := NewPage(first, kittens[:3], 7).NextCursor
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/kittns?cursor="+c, nil)
+	q, _ := testSpec.Parse(r.URL.Query())
+	p := Paginate(q, kittens)
+	h := http.Header{}
+	p.SetHeaders(r, h)
+
+	got := links(h)
+	if got["first"] != "/v1/kittns" {
+		t.Errorf("expected the first page without a cursor, got %s", got["first"])
+	}
+	if got["prev"] != "/v1/kittns?cursor="+p.PrevCursor || got["next"] != "/v1/kittns?cursor="+p.NextCursor {
+		t.Errorf("expected the page cursors, got %v", got)
+	}
+	if !strings.HasPrefix(got["last"], "/v1/kittns?cursor=") {
+		t.Errorf("expected a last page cursor, got %s", got["last"])
+	}
+}
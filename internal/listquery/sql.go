@@ -0,0 +1,124 @@
+package listquery
+
+import (
+	"strings"
+)
+
+var sqlOps = map[Op]string{
+	Eq:  "=",
+	Ne:  "<>",
+	Gt:  ">",
+	Gte: ">=",
+	Lt:  "<",
+	Lte: "<=",
+}
+
+var likeEscape = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Where returns the WHERE clause for the filters and its args, it's empty when there aren't any filters.
+// The columns come from the Spec and the values are ? placeholders, the clause starts with a space
+//
+//	where, args := q.Where()
+//	db.Get(ctx, db.Conn(), scanCount, `SELECT COUNT(*) FROM kittns`+where, args...)
+func (q Query) Where() (string, []any) {
+	var conds []string
+	var args []any
+	for _, f := range q.Filters {
+		col := q.spec.column(f.Field)
+		switch f.Op {
+		case In:
+			vals := f.Value.([]any)
+			conds = append(conds, col+" IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(vals)), ", ")+")")
+			args = append(args, vals...)
+		case Like:
+			conds = append(conds, "LOWER("+col+`) LIKE ? ESCAPE '\'`)
+			args = append(args, "%"+likeEscape.Replace(strings.ToLower(f.Value.(string)))+"%")
+		default:
+			conds = append(conds, col+" "+sqlOps[f.Op]+" ?")
+			args = append(args, f.Value)
+		}
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Seek returns the condition for the items after (or before) the cursor's sort values and its args,
+// it's empty when the page isn't selected by a cursor with values. A sort of a, b is
+//
+//	(a > ? OR (a = ? AND b > ?))
+//
+// with < for the descending fields, the sort columns shouldn't be nullable
+func (q Query) Seek() (string, []any) {
+	if len(q.seek) == 0 {
+		return "", nil
+	}
+	var conds []string
+	var args []any
+	for i, s := range q.Sort {
+		var cond []string
+		for j := range q.Sort[:i] {
+			cond = append(cond, q.spec.column(q.Sort[j].Field)+" = ?")
+			args = append(args, q.seek[j])
+		}
+		op := ">"
+		if s.Desc != q.before {
+			op = "<"
+		}
+		cond = append(cond, q.spec.column(s.Field)+" "+op+" ?")
+		args = append(args, q.seek[i])
+
+		c := strings.Join(cond, " AND ")
+		if len(cond) > 1 {
+			c = "(" + c + ")"
+		}
+		conds = append(conds, c)
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// OrderBy returns the ORDER BY clause for the sort, it's empty when there isn't a sort.
+// The order is reversed for the page before a cursor, NewPage puts the items back in order
+func (q Query) OrderBy() string {
+	if len(q.Sort) == 0 {
+		return ""
+	}
+	cols := make([]string, len(q.Sort))
+	for i, s := range q.Sort {
+		cols[i] = q.spec.column(s.Field)
+		if s.Desc != q.before {
+			cols[i] += " DESC"
+		}
+	}
+	return " ORDER BY " + strings.Join(cols, ", ")
+}
+
+// Limits returns the LIMIT and OFFSET clause for the page and its args,
+// a cursor page selects one extra item to find if there's another page
+func (q Query) Limits() (string, []any) {
+	if q.Cursor {
+		return " LIMIT ? OFFSET ?", []any{q.Limit + 1, 0}
+	}
+	return " LIMIT ? OFFSET ?", []any{q.Limit, q.Offset}
+}
+
+// SQL appends the where, order by and limit clauses to the select query,
+// the cursor's Seek is added to the where clause
+//
+//	query, args := q.SQL(`SELECT id, name, breed, fluffiness, cuteness FROM kittns`)
+//	kl, err := db.Select(ctx, db.Conn(), scanKitten, query, args...)
+func (q Query) SQL(query string) (string, []any) {
+	where, args := q.Where()
+	if seek, sargs := q.Seek(); seek != "" {
+		if where == "" {
+			where = " WHERE " + seek
+		} else {
+			where += " AND " + seek
+		}
+		args = append(args, sargs...)
+	}
+	limits, largs := q.Limits()
+	return query + where + q.OrderBy() + limits, append(args, largs...)
+}
@@ -0,0 +1,54 @@
+package listquery
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestSQL(t *testing.T) {
+	v, _ := url.ParseQuery("limit=5&offset=10&sort=-cute&breed[in]=calico,tabby&cute[gte]=5")
+	v.Set("name[like]", "50%_off")
+	q, errs := testSpec.Parse(v)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	query, args := q.SQL("SELECT * FROM kittns")
+	want := `SELECT * FROM kittns WHERE breed IN (?, ?) AND cuteness >= ? AND LOWER(name) LIKE ? ESCAPE '\' ORDER BY cuteness DESC, id LIMIT ? OFFSET ?`
+	if query != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, query)
+	}
+	wantArgs := []any{"calico", "tabby", int64(5), `%50\%\_off%`, 5, 10}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("expected %v, got %v", wantArgs, args)
+	}
+
+	q, _ = testSpec.Parse(url.Values{})
+	if where, args := q.Where(); where != "" || args != nil {
+		t.Errorf("expected no where clause, got %q %v", where, args)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	q, _ := testSpec.Parse(url.Values{"sort": {"-cute,name"}, "breed": {"calico"}, "limit": {"2"}})
+	after, _ := testSpec.Parse(url.Values{"sort": {"-cute,name"}, "breed": {"calico"}, "limit": {"2"}, "cursor": {q.encodeCursor([]any{int64(7), "max", int64(3)}, false)}})
+
+	query, args := after.SQL("SELECT * FROM kittns")
+	want := "SELECT * FROM kittns WHERE breed = ? AND (cuteness < ? OR (cuteness = ? AND name > ?) OR (cuteness = ? AND name = ? AND id > ?)) ORDER BY cuteness DESC, name, id LIMIT ? OFFSET ?"
+	if query != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, query)
+	}
+	wantArgs := []any{"calico", int64(7), int64(7), "max", int64(7), "max", int64(3), 3, 0}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("expected %v, got %v", wantArgs, args)
+	}
+
+	// the page before the cursor is selected in reverse
+	before, _ := testSpec.Parse(url.Values{"sort": {"-cute,name"}, "cursor": {q.encodeCursor([]any{int64(7), "max", int64(3)}, true)}})
+	query, _ = before.SQL("SELECT * FROM kittns")
+	want = "SELECT * FROM kittns WHERE (cuteness > ? OR (cuteness = ? AND name < ?) OR (cuteness = ? AND name = ? AND id < ?)) ORDER BY cuteness, name DESC, id DESC LIMIT ? OFFSET ?"
+	if query != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, query)
+	}
+}
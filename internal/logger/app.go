@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+)
+
+type ctxAppKey int
+
+const appKey ctxAppKey = 0
+
+// app is the structured application logger, it's the slog default
+// until InitLogger is called
+var app = slog.Default()
+
+// App returns the application logger
+func App() *slog.Logger {
+	return app
+}
+
+// initApp creates the application logger, it writes JSON to the request log sinks
+// and stderr at the info level, or the debug level when Debug is set.
+// It's set as the slog default so the log package is written through it as well
+func (o *Options) initApp() {
+	level := slog.LevelInfo
+	if o.Debug {
+		level = slog.LevelDebug
+	}
+
+	h := slog.NewJSONHandler(io.MultiWriter(sinkWriter{o.sinks}, os.Stderr), &slog.HandlerOptions{Level: level})
+	app = slog.New(h).With("log", "app")
+	slog.SetDefault(app)
+}
+
+// WithLogger adds the logger to the context
+func WithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, appKey, l)
+}
+
+// Ctx returns the request's application logger with the request id attached,
+// the app logger is returned when the context doesn't have one
+func Ctx(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(appKey).(*slog.Logger); ok {
+		return l
+	}
+	return app
+}
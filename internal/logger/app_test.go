@@ -0,0 +1,52 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestAppLogger(t *testing.T) {
+	prev := slog.Default()
+	defer func() { slog.SetDefault(prev); app = prev }()
+
+	for _, debug := range []bool{false, true} {
+		sink := &memSink{}
+		o := testLogger(sink)
+		o.Debug = debug
+		o.initApp()
+
+		slog.Debug("adding route", "path", "/v1/kittns")
+		App().Info("running api", "port", 9876)
+		if err := o.sinks.close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		var logs []string
+		for _, r := range sink.records {
+			logs = append(logs, string(r))
+		}
+		want := 1
+		if debug {
+			want = 2
+		}
+		if len(logs) != want {
+			t.Fatalf("debug %t expected %d app logs, got %q", debug, want, logs)
+		}
+		last := logs[len(logs)-1]
+		if !strings.Contains(last, `"log":"app"`) || !strings.Contains(last, `"msg":"running api"`) || !strings.Contains(last, `"port":9876`) {
+			t.Errorf("expected a json app log, got %s", last)
+		}
+	}
+}
+
+func TestCtx(t *testing.T) {
+	if Ctx(context.Background()) != App() {
+		t.Error("expected the app logger without a request logger")
+	}
+	l := App().With("request_id", "req-1")
+	if Ctx(WithLogger(context.Background(), l)) != l {
+		t.Error("expected the request's logger")
+	}
+}
@@ -0,0 +1,166 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultMaxReqBody is the number of request body bytes kept for the log when MaxBodySize isn't set
+const DefaultMaxReqBody = 64 << 10 // 64KB
+
+// bodyTee copies the start of the request body as the handler reads it,
+// the body is streamed to the handler and never buffered past the limit
+type bodyTee struct {
+	io.ReadCloser
+	limit     func() int // resolved on the first read after the endpoint's redaction is set
+	max       int
+	buf       []byte
+	size      int       // the number of bytes read by the handler
+	hash      hash.Hash // sha256 of the bytes read, only set for binary bodies
+	truncated bool
+}
+
+// teeBody replaces the request body with a bodyTee
+func teeBody(r *http.Request, limit func() int) *bodyTee {
+	t := &bodyTee{limit: limit, max: -1}
+	if r.Body == nil || r.Body == http.NoBody {
+		return t
+	}
+	if kind(r.Header.Get("Content-Type")) == binaryBody {
+		t.hash = sha256.New()
+	}
+	t.ReadCloser = r.Body
+	r.Body = t
+	return t
+}
+
+func (t *bodyTee) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n == 0 {
+		return n, err
+	}
+	if t.max == -1 {
+		t.max = t.limit()
+	}
+
+	t.size += n
+	if t.hash != nil {
+		t.hash.Write(p[:n])
+	}
+	b := p[:n]
+	if room := t.max - len(t.buf); room < len(b) {
+		b = b[:max(room, 0)]
+		t.truncated = true
+	}
+	t.buf = append(t.buf, b...)
+	return n, err
+}
+
+// body kinds decided by the request's content type
+const (
+	jsonBody = iota
+	formBody
+	multipartBody
+	textBody
+	binaryBody
+	unknownBody
+)
+
+// kind returns how a body with the content type is written to the log
+func kind(contentType string) int {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mt == "":
+		return unknownBody
+	case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+		return jsonBody
+	case mt == "application/x-www-form-urlencoded":
+		return formBody
+	case mt == "multipart/form-data":
+		return multipartBody
+	case strings.HasPrefix(mt, "text/") || mt == "application/xml" || strings.HasSuffix(mt, "+xml"):
+		return textBody
+	default:
+		return binaryBody
+	}
+}
+
+// body returns the request body read by the handler for the log with the redacted fields masked.
+// JSON is decoded, form data is decoded into its fields, text is written as a string and
+// binary bodies are summarised by their size and sha256. Bodies without a content type are
+// decoded when they are json, truncated json and text are masked as text
+func (r *Redaction) body(t *bodyTee, contentType string) (body any, truncated bool) {
+	if t.size == 0 || r.SkipBody {
+		return nil, false
+	}
+
+	k := kind(contentType)
+	if k == unknownBody {
+		k = textBody
+		if json.Valid(t.buf) {
+			k = jsonBody
+		}
+	}
+
+	switch k {
+	case jsonBody:
+		var v any
+		if t.truncated || json.Unmarshal(t.buf, &v) != nil {
+			return r.maskRaw(string(t.buf)), t.truncated
+		}
+		r.mask(v)
+		return v, false
+	case formBody:
+		vals, _ := url.ParseQuery(string(t.buf))
+		form := make(map[string]any)
+		for k, v := range vals {
+			form[k] = strings.Join(v, ", ")
+		}
+		r.mask(form)
+		return form, t.truncated
+	case multipartBody:
+		_, params, _ := mime.ParseMediaType(contentType)
+		form := multipartForm(t.buf, params["boundary"])
+		r.mask(form)
+		return form, t.truncated
+	case textBody:
+		return r.maskRaw(string(t.buf)), t.truncated
+	default:
+		return map[string]any{
+			"content_type": contentType,
+			"size":         t.size,
+			"sha256":       hex.EncodeToString(t.hash.Sum(nil)),
+		}, false
+	}
+}
+
+// multipartForm decodes the form values in the captured body,
+// file parts are summarised by their name, content type and captured size
+func multipartForm(buf []byte, boundary string) map[string]any {
+	form := make(map[string]any)
+	mr := multipart.NewReader(bytes.NewReader(buf), boundary)
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			return form // the end of the form or of the captured bytes
+		}
+		b, _ := io.ReadAll(p)
+		if p.FileName() != "" {
+			form[p.FormName()] = map[string]any{
+				"filename":     p.FileName(),
+				"content_type": p.Header.Get("Content-Type"),
+				"size":         len(b),
+			}
+			continue
+		}
+		form[p.FormName()] = string(b)
+	}
+}
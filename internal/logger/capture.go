@@ -0,0 +1,123 @@
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxRespBody is the number of response body bytes captured when MaxBodySize isn't set
+const DefaultMaxRespBody = 4096
+
+// Capture controls when response bodies are copied into the request log.
+// An endpoint's Capture replaces the one in the log options
+type Capture struct {
+	Status      []string `toml:"status" json:"status" comment:"status classes (4xx, 5xx) or codes (404) that are captured, every response is captured when empty"`
+	MaxBodySize int      `toml:"max_body_size" json:"max_body_size" comment:"max bytes of the response body written to the log (default 4096)"`
+	Disabled    bool     `toml:"disabled" json:"disabled" comment:"don't capture response bodies"`
+}
+
+// Validate checks the status classes and codes
+func (c *Capture) Validate() error {
+	if c == nil {
+		return nil
+	}
+	for _, s := range c.Status {
+		if _, _, err := parseStatus(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match returns true when the response body for the status should be captured
+func (c *Capture) Match(status int) bool {
+	if c == nil || c.Disabled {
+		return false
+	}
+	if len(c.Status) == 0 {
+		return true
+	}
+	for _, s := range c.Status {
+		lo, hi, err := parseStatus(s)
+		if err != nil {
+			continue // checked when the policy is validated
+		}
+		if status >= lo && status <= hi {
+			return true
+		}
+	}
+	return false
+}
+
+// limit is the max number of response body bytes captured
+func (c *Capture) limit() int {
+	if c.MaxBodySize > 0 {
+		return c.MaxBodySize
+	}
+	return DefaultMaxRespBody
+}
+
+// parseStatus returns the range of codes for a status class (4xx) or a single code (404)
+func parseStatus(s string) (lo, hi int, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 3 && strings.HasSuffix(s, "xx") && s[0] >= '1' && s[0] <= '5' {
+		lo = int(s[0]-'0') * 100
+		return lo, lo + 99, nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, fmt.Errorf("invalid capture status %q, use a class i.e., 5xx or a code i.e., 404", s)
+	}
+	return code, code, nil
+}
+
+// respBody returns the captured response body for the request log with the redacted fields and paths
+// masked, json bodies are decoded and other or truncated bodies are written as a string
+func respBody(raw []byte, truncated bool, policy *Redaction) any {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var v any
+	if truncated || json.Unmarshal(raw, &v) != nil {
+		return policy.maskRaw(string(raw))
+	}
+	policy.mask(v)
+	return v
+}
+
+// rawPattern masks a field's values in a body that isn't decoded
+type rawPattern struct {
+	re   *regexp.Regexp
+	repl string
+}
+
+// fieldPatterns matches the string and number values of the named json fields,
+// and the text of the xml elements and the values of the xml attributes with the name
+func fieldPatterns(fields []string) []rawPattern {
+	patterns := make([]rawPattern, 0, 3*len(fields))
+	for _, f := range fields {
+		name := regexp.QuoteMeta(f)
+		patterns = append(patterns,
+			rawPattern{regexp.MustCompile(`(?i)("` + name + `"\s*:\s*)("(?:[^"\\]|\\.)*"?|[-0-9.eE+]+)`), `${1}"` + Mask + `"`},
+			rawPattern{regexp.MustCompile(`(?i)(<(?:[\w.-]+:)?` + name + `(?:\s[^<>]*[^/<>])?>)[^<]*`), `${1}` + Mask},
+			rawPattern{regexp.MustCompile(`(?i)(<[^<>]*\s(?:[\w.-]+:)?` + name + `\s*=\s*)("[^"]*"?|'[^']*'?)`), `${1}"` + Mask + `"`},
+		)
+	}
+	return patterns
+}
+
+// maskRaw masks the values of the redacted fields in a body that can't be
+// decoded i.e., xml or json cut off by MaxBodySize. The paths can't be found
+// in a body that isn't decoded so the whole body is masked when Paths are set
+func (r *Redaction) maskRaw(s string) string {
+	if len(r.paths) > 0 {
+		return Mask
+	}
+	for _, p := range r.patterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
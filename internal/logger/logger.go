@@ -1,14 +1,14 @@
 package logger
 
 import (
-	"bytes"
 	"context"
+	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	jsoniter "github.com/json-iterator/go"
 	"github.com/pcelvng/task-tools/file"
@@ -16,12 +16,15 @@ import (
 
 // File log options
 type Options struct {
-	stdOut io.Writer
-	writer io.Writer
-
-	//writer        file.Writer
-	Rotation      string `toml:"rotation" json:"rotation"`
-	FilePath      string `toml:"file_path" json:"file_path"`
+	stdOut    io.Writer
+	sinks     *pipeline
+	observers []Observer
+
+	Rotation      string         `toml:"rotation" json:"rotation" comment:"close the log file hourly or daily, file_path needs {YYYY}{MM}{DD}{HH} time templates"`
+	FilePath      string         `toml:"file_path" json:"file_path"`
+	Sinks         []*SinkOptions `toml:"sinks" json:"sinks"`
+	Redact        *Redaction     `toml:"redact" json:"redact"`
+	Capture       *Capture       `toml:"capture" json:"capture"`
 	*file.Options `toml:"file_options" json:"file_options"`
 	Pretty        bool `toml:"-" json:"-"`
 	Color         bool `toml:"-" json:"-"`
@@ -35,15 +38,24 @@ type APIErr struct {
 }
 
 type RespBody struct {
-	Msg    string `json:"message,omitempty"`
-	Code   int    `json:"code,omitempty"`
-	Status string `json:"status,omitempty"` // you don't set the status value, that is derived from the status code
+	Msg    string       `json:"message,omitempty"`
+	Code   int          `json:"code,omitempty"`
+	Status string       `json:"status,omitempty"` // you don't set the status value, that is derived from the status code
+	Key    string       `json:"error,omitempty"`  // the endpoint's error key i.e., not_found
+	Errors []FieldError `json:"errors,omitempty"` // lists each field that failed request validation
+}
+
+// FieldError describes why a single request field is invalid
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
 }
 
 type Internal struct {
 	Msg     string `json:"message,omitempty"`
 	Err     error  `json:"-"`
 	ErrText string `json:"error_text,omitempty"`
+	Stack   string `json:"stack,omitempty"` // where the error was created when Debug is on, or where a panic happened
 }
 
 type Log struct {
@@ -52,16 +64,29 @@ type Log struct {
 	URI         string    `json:"request_uri"`
 	Time        time.Time `json:"request_time"`
 	Body        any       `json:"request_body,omitempty"`
+	Truncated   bool      `json:"request_body_truncated,omitempty"`
+	ReqSize     int       `json:"request_size"`
 	ContentLen  int64     `json:"content_length,omitempty"`
 	Method      string    `json:"method"`
+	Route       string    `json:"route,omitempty"` // the matched route pattern i.e., /v1/kittns/{id}
 	RemoteAddr  string    `json:"remote_address"`
 	UserAgent   string    `json:"user_agent,omitempty"`
 	ContentType string    `json:"content_type,omitempty"`
+	Principal   string    `json:"principal,omitempty"`
+	TraceID     string    `json:"trace_id,omitempty"`
+	SpanID      string    `json:"span_id,omitempty"`
 	APIError    *Internal `json:"error,omitempty"`
 	Latency     float64   `json:"latency"`
 	RespCode    int       `json:"response_code"`
 	Response    string    `json:"response"`
+	RespSize    int       `json:"response_size"` // the uncompressed size of the response body
+	RespBody    any       `json:"response_body,omitempty"`
+	RespTrunc   bool      `json:"response_body_truncated,omitempty"`
 	NoLog       bool      `json:"-"` // will cancel the request log
+
+	Headers map[string]string `json:"request_headers,omitempty"` // the headers captured by the Redaction
+	Redact  *Redaction        `json:"-"`                         // the endpoint's redaction, merged with the options Redact
+	Capture *Capture          `json:"-"`                         // the endpoint's response capture, replaces the options Capture
 }
 
 type ctxRequestKey int
@@ -70,26 +95,106 @@ const RequestKey ctxRequestKey = 0
 
 var json = jsoniter.ConfigFastest
 
-func (o *Options) InitLogger() {
-	if o.FilePath == "" {
-		o.FilePath = "nop://"
+// InitLogger starts the request log sinks and creates the application logger,
+// the FilePath is written with a file sink using the Rotation and file options
+func (o *Options) InitLogger() error {
+	if err := o.Redact.Validate(); err != nil {
+		return fmt.Errorf("invalid log redaction %w", err)
 	}
-	w, err := file.NewWriter(o.FilePath, o.Options)
-	if err != nil {
-		log.Fatalf("could not create request log writer %+v", err)
+	if err := o.Capture.Validate(); err != nil {
+		return fmt.Errorf("invalid response capture %w", err)
+	}
+
+	sinks := o.Sinks
+	if o.FilePath != "" && o.FilePath != "nop://" {
+		sinks = append([]*SinkOptions{{Type: SinkFile, Path: o.FilePath, Rotation: o.Rotation}}, sinks...)
+	}
+	o.sinks = &pipeline{}
+	names := make(map[string]bool)
+	for _, s := range sinks {
+		s.defaults()
+		if err := s.validate(); err != nil {
+			o.sinks.close(context.Background())
+			return fmt.Errorf("invalid log sink %w", err)
+		}
+		if names[s.Name] {
+			o.sinks.close(context.Background())
+			return fmt.Errorf("duplicate log sink name %q", s.Name)
+		}
+		names[s.Name] = true
+
+		sink, err := o.newSink(s)
+		if err != nil {
+			o.sinks.close(context.Background())
+			return fmt.Errorf("log sink %s %w", s.Name, err)
+		}
+		o.sinks.queues = append(o.sinks.queues, newQueue(sink, *s))
 	}
-	o.writer = w
 
 	if o.Debug {
 		o.stdOut = os.Stdout
 	} else {
 		o.stdOut, _ = file.NewWriter("nop://", o.Options)
 	}
+
+	captureStack = o.Debug
+	o.initApp()
+	return nil
+}
+
+// Close writes the queued records and closes the sinks,
+// the signature matches a setup.ShutdownHook
+func (o *Options) Close(ctx context.Context) error {
+	if o.sinks == nil {
+		return nil
+	}
+	return o.sinks.close(ctx)
+}
+
+// errValue wraps the error so a nil error can be stored in an atomic.Value
+type errValue struct{ err error }
+
+// Check returns the error from the last write of each sink,
+// the signature matches a setup.CheckFunc
+func (o *Options) Check(_ context.Context) error {
+	if o.sinks == nil {
+		return nil
+	}
+	for _, q := range o.sinks.queues {
+		if v, ok := q.err.Load().(errValue); ok && v.err != nil {
+			return fmt.Errorf("request log sink %s %w", q.opts.Name, v.err)
+		}
+	}
+	return nil
+}
+
+// SinkStats returns the counters for each request log sink
+func (o *Options) SinkStats() []SinkStat {
+	if o.sinks == nil {
+		return nil
+	}
+	stats := make([]SinkStat, 0, len(o.sinks.queues))
+	for _, q := range o.sinks.queues {
+		stats = append(stats, SinkStat{
+			Name:    q.opts.Name,
+			Type:    q.opts.Type,
+			Queued:  len(q.records),
+			Written: q.written.Load(),
+			Dropped: q.dropped.Load(),
+			Failed:  q.failed.Load(),
+		})
+	}
+	return stats
 }
 
 type StatusRecorder struct {
 	http.ResponseWriter
-	Status int
+	Status    int
+	Size      int    // the number of response body bytes written
+	Body      []byte // the start of the response body when it's captured
+	Truncated bool   // the response body was larger than the captured Body
+
+	capture func() *Capture // the request's capture policy, the body is captured when it matches the Status
 }
 
 func (r *StatusRecorder) WriteHeader(status int) {
@@ -97,6 +202,53 @@ func (r *StatusRecorder) WriteHeader(status int) {
 	r.ResponseWriter.WriteHeader(status)
 }
 
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.Size += n
+	if r.capture != nil {
+		if c := r.capture(); c.Match(r.Status) {
+			r.keep(b[:n], c.limit())
+		}
+	}
+	return n, err
+}
+
+// keep copies the written bytes into Body up to the limit
+func (r *StatusRecorder) keep(b []byte, limit int) {
+	if room := limit - len(r.Body); room < len(b) {
+		b = b[:max(room, 0)]
+		r.Truncated = true
+	}
+	r.Body = append(r.Body, b...)
+}
+
+// Observer is notified when a request starts and after it has finished
+// with the completed request log i.e., to record metrics
+type Observer interface {
+	Start(r *http.Request)
+	Finish(l *Log)
+}
+
+// OtherMethod is the method label for requests that don't use a standard http method
+const OtherMethod = "OTHER"
+
+// KnownMethod returns the method when it's a standard http method and OTHER when it isn't,
+// observers use it so clients can't add metric series or stats with made up methods
+func KnownMethod(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return m
+	}
+	return OtherMethod
+}
+
+// Observe adds an observer to the request logger,
+// observers are called for every request including those with NoLog set
+func (o *Options) Observe(obs Observer) {
+	o.observers = append(o.observers, obs)
+}
+
 func (o *Options) WriteRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		rec := &StatusRecorder{
@@ -112,7 +264,6 @@ func (o *Options) WriteRequest(next http.Handler) http.Handler {
 			Host:        r.Host,
 			URI:         r.RequestURI,
 			Time:        time.Now().UTC(),
-			Body:        retrieveBody(r),
 			ContentLen:  r.ContentLength,
 			Method:      r.Method,
 			RemoteAddr:  r.RemoteAddr,
@@ -120,29 +271,57 @@ func (o *Options) WriteRequest(next http.Handler) http.Handler {
 			ContentType: r.Header.Get("content-type"),
 		}
 
-		r = r.WithContext(context.WithValue(r.Context(), RequestKey, req))
+		for _, obs := range o.observers {
+			obs.Start(r)
+		}
+
+		tee := teeBody(r, func() int {
+			return o.Redact.Merge(req.Redact).bodyLimit()
+		})
+		rec.capture = func() *Capture {
+			if req.Capture != nil {
+				return req.Capture
+			}
+			return o.Capture
+		}
+
+		ctx := context.WithValue(r.Context(), RequestKey, req)
+		r = r.WithContext(WithLogger(ctx, app.With("request_id", id)))
 		next.ServeHTTP(rec, r)
+
+		req.Latency = time.Since(start).Seconds()
+		req.RespCode = rec.Status
+		req.RespSize = rec.Size
+		req.ReqSize = tee.size
+		req.Response = http.StatusText(req.RespCode)
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			req.Route = rctx.RoutePattern()
+		}
+		for _, obs := range o.observers {
+			obs.Finish(req)
+		}
+
 		if req.NoLog {
 			return // return without writing log output
 		}
+		policy := o.Redact.Merge(req.Redact)
+		req.Body, req.Truncated = policy.body(tee, req.ContentType)
+		req.RespBody, req.RespTrunc = respBody(rec.Body, rec.Truncated, policy), rec.Truncated
+		req.Headers = policy.headers(r.Header)
 		var body []byte
-		req.Latency = time.Since(start).Seconds()
-		req.RespCode = rec.Status
-		req.Response = http.StatusText(req.RespCode)
 		if o.Pretty {
 			body, err = json.MarshalIndent(req, "", "  ")
 			if err != nil {
-				log.Printf("error marshal request object %v", err)
+				app.Error("could not marshal request log", "error", err)
 			}
 		} else {
 			body, err = json.Marshal(req)
 			if err != nil {
-				log.Printf("error marshal request object %v", err)
+				app.Error("could not marshal request log", "error", err)
 			}
 		}
 
-		o.writer.Write(body)
-		o.writer.Write([]byte("\n"))
+		o.sinks.send(body)
 
 		if o.Color {
 			if req.APIError != nil || req.RespCode/200 != 1 {
@@ -161,43 +340,16 @@ func (o *Options) WriteRequest(next http.Handler) http.Handler {
 	})
 }
 
-func retrieveBody(req *http.Request) (i any) {
-	buf, err := io.ReadAll(req.Body)
-	if err != nil {
-		return "could not read request body " + err.Error()
-	}
-
-	if len(buf) == 0 {
-		return nil
-	}
-
-	// one read closer for modifing and one to set back to the request
-	b := io.NopCloser(bytes.NewBuffer(buf))
-	req.Body = io.NopCloser(bytes.NewBuffer(buf))
-
-	// read the request body
-	body, err := io.ReadAll(b)
-	if err != nil {
-		return "could not read request body copy " + err.Error()
-	}
-
-	if len(body) == 0 {
-		return ""
-	}
-
-	err = json.Unmarshal(body, &i)
-	if err != nil {
-		return "request body is not valid json"
-	}
-
-	return i
-}
-
 func (a *APIErr) Error() string {
 	body, _ := json.MarshalToString(a.RespBody)
 	return body
 }
 
+// Unwrap returns the internal error so errors.Is and errors.As check it
+func (a *APIErr) Unwrap() error {
+	return a.Err
+}
+
 func FromContext(ctx context.Context) (found bool, a APIErr) {
 	v := ctx.Value("error")
 	if v == nil {
@@ -224,6 +376,7 @@ func NewError(internal, external string, code int, err error) *APIErr {
 	if err != nil {
 		a.ErrText = err.Error()
 	}
+	a.Stack = Stack(1)
 
 	return a
 }
@@ -0,0 +1,104 @@
+package logger
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// memSink keeps the written records
+type memSink struct {
+	mu      sync.Mutex
+	records [][]byte
+}
+
+func (s *memSink) Write(records [][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+// testLogger returns options that write the request logs to the sink
+func testLogger(sink Sink) *Options {
+	return &Options{
+		stdOut:  io.Discard,
+		sinks:   &pipeline{queues: []*queue{newQueue(sink, SinkOptions{Name: "mem", BufferSize: 10, BatchSize: 1, FlushInterval: time.Millisecond, Backpressure: Block})}},
+		Capture: &Capture{Status: []string{"4xx"}},
+	}
+}
+
+func TestWriteRequestCompressed(t *testing.T) {
+	const body = `{"message":"kittn id was not found: 7","code":404}`
+	sink := &memSink{}
+	o := testLogger(sink)
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, body)
+	})
+	// the same order as main.go, the compressor is outside of the request logger
+	srv := middleware.RequestID(middleware.Compress(9)(o.WriteRequest(h)))
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/kittns/7", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzip response, got %q", w.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != body {
+		t.Fatalf("unexpected response %q", b)
+	}
+
+	if err := o.sinks.close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.records) != 1 {
+		t.Fatalf("expected 1 request log, got %d", len(sink.records))
+	}
+	var l struct {
+		RespSize int            `json:"response_size"`
+		RespBody map[string]any `json:"response_body"`
+	}
+	if err := json.Unmarshal(sink.records[0], &l); err != nil {
+		t.Fatalf("the captured body isn't readable %v %s", err, sink.records[0])
+	}
+	if l.RespSize != len(body) {
+		t.Errorf("expected the uncompressed size %d, got %d", len(body), l.RespSize)
+	}
+	if msg, _ := l.RespBody["message"].(string); !strings.Contains(msg, "not found") {
+		t.Errorf("expected the captured json body, got %v", l.RespBody)
+	}
+}
+
+func TestKnownMethod(t *testing.T) {
+	for m, want := range map[string]string{
+		http.MethodGet:     http.MethodGet,
+		http.MethodPatch:   http.MethodPatch,
+		http.MethodOptions: http.MethodOptions,
+		"get":              OtherMethod,
+		"PROPFIND":         OtherMethod,
+		"":                 OtherMethod,
+	} {
+		if got := KnownMethod(m); got != want {
+			t.Errorf("%q expected %s, got %s", m, want, got)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package logger
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// ContentProblem is the content type for RFC 7807 problem details
+const ContentProblem = "application/problem+json"
+
+// Problem is an RFC 7807 problem details error response
+type Problem struct {
+	Type     string       `json:"type"`               // a uri for the kind of problem, about:blank when it's described by the status
+	Title    string       `json:"title"`              // the status text
+	Status   int          `json:"status"`             // the http status code
+	Detail   string       `json:"detail,omitempty"`   // the external error message
+	Instance string       `json:"instance,omitempty"` // a urn for the request id i.e., urn:request:host%2FAbCd-000001
+	Key      string       `json:"error,omitempty"`    // (extension) the endpoint's error key i.e., not_found
+	Errors   []FieldError `json:"errors,omitempty"`   // (extension) lists each field that failed request validation
+}
+
+// Problem returns the response body as RFC 7807 problem details for the request id,
+// the id is escaped into a urn so the instance is a uri reference
+func (a *APIErr) Problem(requestID string) Problem {
+	var instance string
+	if requestID != "" {
+		instance = "urn:request:" + url.PathEscape(requestID)
+	}
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(a.Code),
+		Status:   a.Code,
+		Detail:   a.RespBody.Msg,
+		Instance: instance,
+		Key:      a.Key,
+		Errors:   a.Errors,
+	}
+}
@@ -0,0 +1,29 @@
+package logger
+
+import (
+	stdjson "encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestProblem(t *testing.T) {
+	a := &APIErr{RespBody: RespBody{
+		Msg:    "the request body has invalid fields",
+		Code:   http.StatusUnprocessableEntity,
+		Key:    "invalid_body",
+		Errors: []FieldError{{Field: "name", Reason: "is required"}},
+	}}
+
+	b, _ := stdjson.Marshal(a.Problem("my-host/AbCd-000001"))
+	want := `{"type":"about:blank","title":"Unprocessable Entity","status":422,"detail":"the request body has invalid fields",` +
+		`"instance":"urn:request:my-host%2FAbCd-000001","error":"invalid_body","errors":[{"field":"name","reason":"is required"}]}`
+	if string(b) != want {
+		t.Errorf("expected %s, got %s", want, b)
+	}
+
+	// the docs examples don't have a request
+	b, _ = stdjson.Marshal((&APIErr{RespBody: RespBody{Code: http.StatusNotFound}}).Problem(""))
+	if string(b) != `{"type":"about:blank","title":"Not Found","status":404}` {
+		t.Errorf("unexpected problem %s", b)
+	}
+}
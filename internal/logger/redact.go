@@ -0,0 +1,247 @@
+package logger
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Mask replaces redacted values in the request log
+const Mask = "[REDACTED]"
+
+// alwaysMasked headers are never written to the request log in clear text
+var alwaysMasked = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// Redaction controls what parts of a request are written to the request log.
+// An endpoint's Redaction is merged with the one in the log options
+type Redaction struct {
+	Fields      []string `toml:"fields" json:"fields" comment:"json field names and xml elements or attributes masked at any depth (case insensitive)"`
+	Paths       []string `toml:"paths" json:"paths" comment:"JSONPath fields masked i.e., $.user.password or $.cards[*].number"`
+	Headers     []string `toml:"headers" json:"headers" comment:"request headers captured in the request log"`
+	MaskHeaders []string `toml:"mask_headers" json:"mask_headers" comment:"captured headers that are masked (Authorization and Cookie are always masked)"`
+	MaxBodySize int      `toml:"max_body_size" json:"max_body_size" comment:"max bytes of the request body kept for the log (default 64KB), larger json bodies are logged as masked text"`
+	SkipBody    bool     `toml:"skip_body" json:"skip_body" comment:"don't write request bodies to the log"`
+
+	patterns []rawPattern // the Fields patterns for bodies that can't be decoded, set by Validate
+	paths    [][]segment  // the parsed Paths, set by Validate
+}
+
+// Merge returns a copy of r with the lists of o added,
+// o's MaxBodySize is used when set and SkipBody is set if either is set
+func (r *Redaction) Merge(o *Redaction) *Redaction {
+	m := &Redaction{}
+	for _, v := range []*Redaction{r, o} {
+		if v == nil {
+			continue
+		}
+		patterns, paths := v.compiled()
+		m.Fields = append(m.Fields, v.Fields...)
+		m.Paths = append(m.Paths, v.Paths...)
+		m.patterns = append(m.patterns, patterns...)
+		m.paths = append(m.paths, paths...)
+		m.Headers = append(m.Headers, v.Headers...)
+		m.MaskHeaders = append(m.MaskHeaders, v.MaskHeaders...)
+		if v.MaxBodySize > 0 {
+			m.MaxBodySize = v.MaxBodySize
+		}
+		m.SkipBody = m.SkipBody || v.SkipBody
+	}
+	return m
+}
+
+// Validate checks the JSONPath expressions can be parsed,
+// the parsed paths and field patterns are kept for the requests
+func (r *Redaction) Validate() error {
+	if r == nil {
+		return nil
+	}
+	paths := make([][]segment, 0, len(r.Paths))
+	for _, p := range r.Paths {
+		segs, err := parsePath(p)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, segs)
+	}
+	r.paths = paths
+	r.patterns = fieldPatterns(r.Fields)
+	return nil
+}
+
+// compiled returns the patterns and paths set by Validate,
+// they are built for a redaction that hasn't been validated
+func (r *Redaction) compiled() ([]rawPattern, [][]segment) {
+	if len(r.patterns) == 3*len(r.Fields) && len(r.paths) == len(r.Paths) {
+		return r.patterns, r.paths
+	}
+	var paths [][]segment
+	for _, p := range r.Paths {
+		if segs, err := parsePath(p); err == nil {
+			paths = append(paths, segs)
+		}
+	}
+	return fieldPatterns(r.Fields), paths
+}
+
+// mask masks the redacted fields and paths in the decoded body
+func (r *Redaction) mask(v any) {
+	fields := make(map[string]bool)
+	for _, f := range r.Fields {
+		fields[strings.ToLower(f)] = true
+	}
+	if len(fields) > 0 {
+		maskFields(v, fields)
+	}
+	for _, segs := range r.paths {
+		maskPath(v, segs)
+	}
+}
+
+// bodyLimit is the number of request body bytes kept for the log
+func (r *Redaction) bodyLimit() int {
+	switch {
+	case r.SkipBody:
+		return 0
+	case r.MaxBodySize > 0:
+		return r.MaxBodySize
+	default:
+		return DefaultMaxReqBody
+	}
+}
+
+// headers returns the captured headers with the masked headers redacted
+func (r *Redaction) headers(h http.Header) map[string]string {
+	if len(r.Headers) == 0 {
+		return nil
+	}
+
+	masked := make(map[string]bool)
+	for _, m := range append(r.MaskHeaders, alwaysMasked...) {
+		masked[http.CanonicalHeaderKey(m)] = true
+	}
+
+	hs := make(map[string]string)
+	for _, name := range r.Headers {
+		name = http.CanonicalHeaderKey(name)
+		v := h.Values(name)
+		if len(v) == 0 {
+			continue
+		}
+		if masked[name] {
+			hs[name] = Mask
+		} else {
+			hs[name] = strings.Join(v, ", ")
+		}
+	}
+	return hs
+}
+
+// maskFields masks the values of the named fields at any depth
+func maskFields(v any, fields map[string]bool) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if fields[strings.ToLower(k)] {
+				t[k] = Mask
+				continue
+			}
+			maskFields(val, fields)
+		}
+	case []any:
+		for _, val := range t {
+			maskFields(val, fields)
+		}
+	}
+}
+
+// segment is a single step of a JSONPath, a field name or an array index (-1 for [*])
+type segment struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+// parsePath parses the supported JSONPath subset $.a.b, $.a[0].b, $.a[*].b and $['a']
+func parsePath(p string) ([]segment, error) {
+	if !strings.HasPrefix(p, "$") {
+		return nil, fmt.Errorf("json path %q must start with $", p)
+	}
+
+	var segs []segment
+	s := p[1:]
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end == -1 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("json path %q has an empty field name", p)
+			}
+			segs = append(segs, segment{key: s[:end]})
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("json path %q is missing a ]", p)
+			}
+			in := s[1:end]
+			s = s[end+1:]
+			switch {
+			case in == "*":
+				segs = append(segs, segment{index: -1, isIdx: true})
+			case len(in) > 1 && (in[0] == '\'' || in[0] == '"') && in[len(in)-1] == in[0]:
+				segs = append(segs, segment{key: in[1 : len(in)-1]})
+			default:
+				i, err := strconv.Atoi(in)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("json path %q has an invalid index %q", p, in)
+				}
+				segs = append(segs, segment{index: i, isIdx: true})
+			}
+		default:
+			return nil, fmt.Errorf("json path %q is invalid at %q", p, s)
+		}
+	}
+	if len(segs) == 0 {
+		return nil, fmt.Errorf("json path %q doesn't select a field", p)
+	}
+	return segs, nil
+}
+
+// maskPath masks the values selected by the path
+func maskPath(v any, segs []segment) {
+	seg, last := segs[0], len(segs) == 1
+	switch t := v.(type) {
+	case map[string]any:
+		if seg.isIdx {
+			return
+		}
+		val, found := t[seg.key]
+		if !found {
+			return
+		}
+		if last {
+			t[seg.key] = Mask
+			return
+		}
+		maskPath(val, segs[1:])
+	case []any:
+		if !seg.isIdx {
+			return
+		}
+		for i := range t {
+			if seg.index != -1 && seg.index != i {
+				continue
+			}
+			if last {
+				t[i] = Mask
+				continue
+			}
+			maskPath(t[i], segs[1:])
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package logger
+
+import (
+	stdjson "encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactionValidate(t *testing.T) {
+	for _, p := range []string{"user.password", "$", "$.", "$.a[", "$.a[x]", "$.a[-1]", "$a"} {
+		if err := (&Redaction{Paths: []string{p}}).Validate(); err == nil {
+			t.Errorf("%q expected an error", p)
+		}
+	}
+
+	r := &Redaction{Fields: []string{"password"}, Paths: []string{"$.user.pin", "$.cards[*].number", "$['a b'][0]"}}
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.patterns) != 3 || len(r.paths) != 3 { // json, xml element and xml attribute patterns
+		t.Fatalf("expected the compiled patterns and paths, got %d %d", len(r.patterns), len(r.paths))
+	}
+	want := []segment{{key: "a b"}, {index: 0, isIdx: true}}
+	if !reflect.DeepEqual(r.paths[2], want) {
+		t.Errorf("expected %v, got %v", want, r.paths[2])
+	}
+}
+
+func TestRedactionMerge(t *testing.T) {
+	base := &Redaction{Fields: []string{"password"}, MaxBodySize: 10}
+	ep := &Redaction{Fields: []string{"token"}, Paths: []string{"$.pin"}, SkipBody: true}
+	for _, r := range []*Redaction{base, ep} {
+		if err := r.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := base.Merge(ep)
+	if len(m.Fields) != 2 || m.MaxBodySize != 10 || !m.SkipBody || m.bodyLimit() != 0 {
+		t.Errorf("unexpected merge %+v", m)
+	}
+	// the validated patterns are reused for each request
+	if len(m.patterns) != 6 || m.patterns[0] != base.patterns[0] || m.patterns[3] != ep.patterns[0] || len(m.paths) != 1 {
+		t.Errorf("expected the compiled patterns to be merged, got %v %v", m.patterns, m.paths)
+	}
+
+	// a redaction that wasn't validated is still masked
+	m = (*Redaction)(nil).Merge(&Redaction{Fields: []string{"password"}, Paths: []string{"$.pin", "bad"}})
+	if len(m.patterns) != 3 || len(m.paths) != 1 {
+		t.Errorf("expected the patterns to be built, got %v %v", m.patterns, m.paths)
+	}
+	if m.bodyLimit() != DefaultMaxReqBody {
+		t.Errorf("expected the default body limit, got %d", m.bodyLimit())
+	}
+}
+
+func TestRedactionMask(t *testing.T) {
+	r := &Redaction{Fields: []string{"Password"}, Paths: []string{"$.cards[*].number", "$.pins[1]"}}
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var v any
+	json.Unmarshal([]byte(`{"user":{"password":"x","name":"bob"},"cards":[{"number":"1"},{"number":"2","exp":"12/30"}],"pins":[1,2,3]}`), &v)
+	r.mask(v)
+	b, _ := stdjson.Marshal(v)
+
+	want := `{"cards":[{"number":"[REDACTED]"},{"exp":"12/30","number":"[REDACTED]"}],"pins":[1,"[REDACTED]",3],"user":{"name":"bob","password":"[REDACTED]"}}`
+	if string(b) != want {
+		t.Errorf("expected %s, got %s", want, b)
+	}
+}
+
+func TestMaskRaw(t *testing.T) {
+	r := &Redaction{Fields: []string{"password", "pin"}}
+	r.Validate()
+
+	s := r.maskRaw(`{"Password" : "a \"quoted\" pw", "pin": -12.5, "name": "bob", "password":"cut off`)
+	want := `{"Password" : "[REDACTED]", "pin": "[REDACTED]", "name": "bob", "password":"[REDACTED]"`
+	if s != want {
+		t.Errorf("expected %s, got %s", want, s)
+	}
+
+	for body, want := range map[string]string{
+		`<user><name>bob</name><Password>hunter2</Password></user>`:            `<user><name>bob</name><Password>[REDACTED]</Password></user>`,
+		`<user><ns:password type="plain">x &amp; y</ns:password><pin/></user>`: `<user><ns:password type="plain">[REDACTED]</ns:password><pin/></user>`,
+		`<login name="bob" password="hunter2" pin='1234'/>`:                    `<login name="bob" password="[REDACTED]" pin="[REDACTED]"/>`,
+		`<user><password>cut off`:                                              `<user><password>[REDACTED]`,
+		`<user><pin a="1"/>bob</user>`:                                         `<user><pin a="1"/>bob</user>`,
+	} {
+		if s := r.maskRaw(body); s != want {
+			t.Errorf("expected %s, got %s", want, s)
+		}
+	}
+}
+
+func TestRedactionBody(t *testing.T) {
+	r := &Redaction{Fields: []string{"password"}, MaxBodySize: 20}
+	r.Validate()
+
+	cases := map[string]struct {
+		contentType string
+		body        string
+		want        string
+		truncated   bool
+	}{
+		"json":           {contentType: "application/json", body: `{"password":"x"}`, want: `{"password":"[REDACTED]"}`},
+		"truncated json": {contentType: "application/json", body: `{"password":"x","name":"bob"}`, want: `"{\"password\":\"[REDACTED]\",\"nam"`, truncated: true},
+		"form":           {contentType: "application/x-www-form-urlencoded", body: `password=x&a=1`, want: `{"a":"1","password":"[REDACTED]"}`},
+		"text":           {contentType: "text/plain", body: `hello`, want: `"hello"`},
+		"xml":            {contentType: "application/xml", body: `<a password="x"/>`, want: `"\u003ca password=\"[REDACTED]\"/\u003e"`},
+		"no type json":   {body: `{"password":1}`, want: `{"password":"[REDACTED]"}`},
+		"binary":         {contentType: "image/png", body: `png`},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+			if c.contentType != "" {
+				req.Header.Set("Content-Type", c.contentType)
+			}
+			tee := teeBody(req, r.bodyLimit)
+			buf := make([]byte, 4)
+			for {
+				if _, err := req.Body.Read(buf); err != nil {
+					break
+				}
+			}
+
+			body, truncated := r.body(tee, c.contentType)
+			b, _ := stdjson.Marshal(body)
+			if name == "binary" {
+				m := body.(map[string]any)
+				if len(m["sha256"].(string)) != 64 || m["size"] != 3 {
+					t.Errorf("unexpected binary summary %s", b)
+				}
+				return
+			}
+			if string(b) != c.want || truncated != c.truncated {
+				t.Errorf("expected %s %v, got %s %v", c.want, c.truncated, b, truncated)
+			}
+		})
+	}
+}
+
+func TestRedactionHeaders(t *testing.T) {
+	r := &Redaction{Headers: []string{"x-trace", "authorization", "x-secret", "x-missing"}, MaskHeaders: []string{"X-Secret"}}
+	h := http.Header{}
+	h.Set("X-Trace", "abc")
+	h.Set("Authorization", "Bearer t")
+	h.Set("X-Secret", "s")
+
+	want := map[string]string{"X-Trace": "abc", "Authorization": Mask, "X-Secret": Mask}
+	if got := r.headers(h); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if (&Redaction{}).headers(h) != nil {
+		t.Error("expected no headers when none are captured")
+	}
+}
+
+func TestRespBody(t *testing.T) {
+	r := &Redaction{Fields: []string{"token"}}
+	r.Validate()
+
+	b, _ := stdjson.Marshal(respBody([]byte(`{"token":"t","data":[{"token":"u"}]}`), false, r))
+	if string(b) != `{"data":[{"token":"[REDACTED]"}],"token":"[REDACTED]"}` {
+		t.Errorf("unexpected body %s", b)
+	}
+	if s := respBody([]byte(`{"token":"t","da`), true, r); s != `{"token":"[REDACTED]","da` {
+		t.Errorf("unexpected truncated body %v", s)
+	}
+	if respBody(nil, false, r) != nil {
+		t.Error("expected no body")
+	}
+}
+
+func TestRespBodyPaths(t *testing.T) {
+	r := (&Redaction{Fields: []string{"token"}}).Merge(&Redaction{Paths: []string{"$.user.pin"}})
+
+	b, _ := stdjson.Marshal(respBody([]byte(`{"token":"t","user":{"name":"bob","pin":1234}}`), false, r))
+	if string(b) != `{"token":"[REDACTED]","user":{"name":"bob","pin":"[REDACTED]"}}` {
+		t.Errorf("expected the path to be masked, got %s", b)
+	}
+	// a path can't be found in a truncated body so all of it is masked
+	if s := respBody([]byte(`{"user":{"pin":1234,"na`), true, r); s != Mask {
+		t.Errorf("expected the truncated body to be masked, got %v", s)
+	}
+	tee := &bodyTee{buf: []byte(`{"user":{"pin":1234,"na`), size: 100, truncated: true}
+	if body, _ := r.body(tee, "application/json"); body != Mask {
+		t.Errorf("expected the truncated request body to be masked, got %v", body)
+	}
+}
@@ -0,0 +1,269 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pcelvng/task-tools/bus"
+)
+
+// Sink types
+const (
+	SinkFile   = "file"
+	SinkStdout = "stdout"
+	SinkSyslog = "syslog"
+	SinkHTTP   = "http"
+	SinkBus    = "bus"
+)
+
+// Backpressure policies used when a sink's queue is full
+const (
+	Drop  = "drop"  // the record is dropped and counted
+	Block = "block" // the request waits for room in the queue
+)
+
+// Sink writes batches of request log records to a destination,
+// each record is a single json log line without the trailing newline
+type Sink interface {
+	Write(records [][]byte) error
+	Close() error
+}
+
+// SinkOptions configures a request log destination and its queue
+type SinkOptions struct {
+	Name          string        `toml:"name" json:"name" comment:"name used in the sink metrics and errors (default the type)"`
+	Type          string        `toml:"type" json:"type" comment:"file, stdout, syslog, http or bus"`
+	Path          string        `toml:"path" json:"path" comment:"file path for the file sink, the log_options file_options are used"`
+	Rotation      string        `toml:"rotation" json:"rotation" comment:"close the file hourly or daily, the path needs {YYYY}{MM}{DD}{HH} time templates"`
+	URL           string        `toml:"url" json:"url" comment:"collector url for the http sink, records are posted as newline delimited json"`
+	Timeout       time.Duration `toml:"timeout" json:"timeout" comment:"timeout for each http sink request (default 10s)"`
+	Network       string        `toml:"network" json:"network" comment:"syslog network tcp or udp, the local syslog is used when empty"`
+	Address       string        `toml:"address" json:"address" comment:"syslog server host:port"`
+	Tag           string        `toml:"tag" json:"tag" comment:"syslog tag (default rest-api)"`
+	Topic         string        `toml:"topic" json:"topic" comment:"topic the bus sink sends records to"`
+	Bus           *bus.Options  `toml:"bus" json:"bus"`
+	BufferSize    int           `toml:"buffer_size" json:"buffer_size" comment:"number of records queued for the sink (default 1024)"`
+	BatchSize     int           `toml:"batch_size" json:"batch_size" comment:"max records written to the sink at once (default 100)"`
+	FlushInterval time.Duration `toml:"flush_interval" json:"flush_interval" comment:"max time a record waits in a partial batch (default 1s)"`
+	Backpressure  string        `toml:"backpressure" json:"backpressure" comment:"drop or block when the queue is full (default drop)"`
+}
+
+// SinkStat are the counters for a sink
+type SinkStat struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Queued  int    `json:"queued"`
+	Written int64  `json:"written"`
+	Dropped int64  `json:"dropped"`
+	Failed  int64  `json:"failed"` // records in batches the sink failed to write
+}
+
+// defaults fills in the unset queue options
+func (s *SinkOptions) defaults() {
+	if s.Name == "" {
+		s.Name = s.Type
+	}
+	if s.BufferSize <= 0 {
+		s.BufferSize = 1024
+	}
+	if s.BatchSize <= 0 {
+		s.BatchSize = 100
+	}
+	if s.FlushInterval <= 0 {
+		s.FlushInterval = time.Second
+	}
+	if s.Backpressure == "" {
+		s.Backpressure = Drop
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = 10 * time.Second
+	}
+	if s.Tag == "" {
+		s.Tag = "rest-api"
+	}
+}
+
+// validate checks the sink has the options its type needs
+func (s *SinkOptions) validate() error {
+	if s.Backpressure != Drop && s.Backpressure != Block {
+		return fmt.Errorf("sink %s has an invalid backpressure %q, use drop or block", s.Name, s.Backpressure)
+	}
+	switch s.Type {
+	case SinkFile:
+		if s.Path == "" {
+			return fmt.Errorf("file sink %s needs a path", s.Name)
+		}
+		return validRotation(s.Rotation, s.Path)
+	case SinkStdout, SinkSyslog:
+		return nil
+	case SinkHTTP:
+		if s.URL == "" {
+			return fmt.Errorf("http sink %s needs a url", s.Name)
+		}
+	case SinkBus:
+		if s.Topic == "" || s.Bus == nil {
+			return fmt.Errorf("bus sink %s needs a topic and bus options", s.Name)
+		}
+	default:
+		return fmt.Errorf("unknown sink type %q", s.Type)
+	}
+	return nil
+}
+
+// newSink creates the sink for the type
+func (o *Options) newSink(s *SinkOptions) (Sink, error) {
+	switch s.Type {
+	case SinkFile:
+		return newFileSink(s.Path, s.Rotation, o.Options)
+	case SinkStdout:
+		return stdoutSink{}, nil
+	case SinkSyslog:
+		return newSyslogSink(s.Network, s.Address, s.Tag)
+	case SinkHTTP:
+		return newHTTPSink(s.URL, s.Timeout), nil
+	case SinkBus:
+		return newBusSink(s.Topic, s.Bus)
+	}
+	return nil, fmt.Errorf("unknown sink type %q", s.Type)
+}
+
+// queue batches records for a sink on its own goroutine
+// so a slow sink doesn't hold up requests or the other sinks
+type queue struct {
+	Sink
+	opts    SinkOptions
+	records chan []byte
+	done    chan struct{}
+	err     atomic.Value // errValue of the last write
+
+	written, dropped, failed atomic.Int64
+}
+
+func newQueue(s Sink, opts SinkOptions) *queue {
+	q := &queue{
+		Sink:    s,
+		opts:    opts,
+		records: make(chan []byte, opts.BufferSize),
+		done:    make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// run writes the queued records in batches until the queue is closed,
+// a partial batch is written after the FlushInterval
+func (q *queue) run() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, q.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		err := q.Write(batch)
+		if err != nil {
+			q.failed.Add(int64(len(batch)))
+		} else {
+			q.written.Add(int64(len(batch)))
+		}
+		q.err.Store(errValue{err})
+		batch = make([][]byte, 0, q.opts.BatchSize)
+	}
+
+	for {
+		select {
+		case rec, ok := <-q.records:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, rec)
+			if len(batch) >= q.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// send queues the record using the sink's backpressure policy
+func (q *queue) send(rec []byte) {
+	if q.opts.Backpressure == Block {
+		q.records <- rec
+		return
+	}
+	select {
+	case q.records <- rec:
+	default:
+		q.dropped.Add(1)
+	}
+}
+
+// pipeline fans out the request log records to each sink's queue
+type pipeline struct {
+	mu     sync.RWMutex
+	closed bool
+	queues []*queue
+}
+
+// send queues the record for every sink, records sent after Close are dropped
+func (p *pipeline) send(rec []byte) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, q := range p.queues {
+		if p.closed {
+			q.dropped.Add(1)
+			continue
+		}
+		q.send(rec)
+	}
+}
+
+// close stops the queues and waits for the queued records to be written
+// before the sinks are closed, the context limits how long the flush can take
+func (p *pipeline) close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	for _, q := range p.queues {
+		close(q.records)
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for _, q := range p.queues {
+		select {
+		case <-q.done:
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("sink %s flush %w", q.opts.Name, ctx.Err()))
+			continue
+		}
+		if err := q.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s close %w", q.opts.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sinkWriter sends each write as a record, it's used for the application logger
+type sinkWriter struct{ p *pipeline }
+
+func (w sinkWriter) Write(b []byte) (int, error) {
+	rec := make([]byte, len(b))
+	copy(rec, b)
+	if n := len(rec); n > 0 && rec[n-1] == '\n' {
+		rec = rec[:n-1]
+	}
+	w.p.send(rec)
+	return len(b), nil
+}
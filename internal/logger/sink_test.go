@@ -0,0 +1,274 @@
+package logger
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pcelvng/task-tools/file"
+)
+
+// blockSink holds each write until it's released
+type blockSink struct {
+	memSink
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockSink() *blockSink {
+	return &blockSink{started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (s *blockSink) Write(records [][]byte) error {
+	s.started <- struct{}{}
+	<-s.release
+	return s.memSink.Write(records)
+}
+
+func testQueue(s Sink, backpressure string) *pipeline {
+	opts := SinkOptions{Name: "test", BufferSize: 1, BatchSize: 1, FlushInterval: time.Hour, Backpressure: backpressure}
+	return &pipeline{queues: []*queue{newQueue(s, opts)}}
+}
+
+func TestQueueDrop(t *testing.T) {
+	s := newBlockSink()
+	p := testQueue(s, Drop)
+	q := p.queues[0]
+
+	p.send([]byte("1"))
+	<-s.started // the first record is being written
+	p.send([]byte("2"))
+	p.send([]byte("3")) // the queue is full
+	p.send([]byte("4"))
+	if n := q.dropped.Load(); n != 2 {
+		t.Errorf("expected 2 dropped records, got %d", n)
+	}
+
+	close(s.release)
+	if err := p.close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if q.written.Load() != 2 || len(s.records) != 2 || string(s.records[1]) != "2" {
+		t.Errorf("expected the queued records to be written, got %q", s.records)
+	}
+}
+
+func TestQueueBlock(t *testing.T) {
+	s := newBlockSink()
+	p := testQueue(s, Block)
+
+	p.send([]byte("1"))
+	<-s.started
+	p.send([]byte("2"))
+
+	sent := make(chan struct{})
+	go func() {
+		p.send([]byte("3"))
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		t.Fatal("expected the send to wait for room in the queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(s.release)
+	<-sent
+	if err := p.close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if q := p.queues[0]; q.dropped.Load() != 0 || q.written.Load() != 3 {
+		t.Errorf("expected every record to be written, got %d written %d dropped", q.written.Load(), q.dropped.Load())
+	}
+}
+
+// closeSink records if it was closed
+type closeSink struct {
+	memSink
+	closed bool
+	err    error
+}
+
+func (s *closeSink) Write(records [][]byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.memSink.Write(records)
+}
+
+func (s *closeSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestPipelineClose(t *testing.T) {
+	s := &closeSink{}
+	p := &pipeline{queues: []*queue{newQueue(s, SinkOptions{Name: "test", BufferSize: 10, BatchSize: 100, FlushInterval: time.Hour, Backpressure: Drop})}}
+
+	for _, rec := range []string{"1", "2", "3"} {
+		p.send([]byte(rec))
+	}
+	if err := p.close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// the partial batch is written when the pipeline is closed
+	if len(s.records) != 3 || !s.closed {
+		t.Errorf("expected the partial batch to be flushed and the sink closed, got %q %t", s.records, s.closed)
+	}
+
+	p.send([]byte("4"))
+	if n := p.queues[0].dropped.Load(); n != 1 || len(s.records) != 3 {
+		t.Errorf("expected records sent after close to be dropped, got %d dropped", n)
+	}
+	if err := p.close(context.Background()); err != nil {
+		t.Errorf("expected a second close to be a no-op, got %v", err)
+	}
+}
+
+func TestPipelineCloseTimeout(t *testing.T) {
+	s := newBlockSink()
+	defer close(s.release)
+	p := testQueue(s, Drop)
+	p.send([]byte("1"))
+	<-s.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := p.close(ctx); err == nil || !strings.Contains(err.Error(), "sink test flush") {
+		t.Errorf("expected the flush to time out, got %v", err)
+	}
+}
+
+func TestSinkCheck(t *testing.T) {
+	s := &closeSink{err: errors.New("collector is down")}
+	o := &Options{sinks: &pipeline{queues: []*queue{newQueue(s, SinkOptions{Name: "http", Type: SinkHTTP, BufferSize: 10, BatchSize: 1, FlushInterval: time.Hour, Backpressure: Drop})}}}
+
+	o.sinks.send([]byte("1"))
+	o.Close(context.Background())
+	if err := o.Check(context.Background()); err == nil || !strings.Contains(err.Error(), "request log sink http collector is down") {
+		t.Errorf("expected the sink error, got %v", err)
+	}
+	stats := o.SinkStats()
+	if len(stats) != 1 || stats[0].Failed != 1 || stats[0].Written != 0 || stats[0].Type != SinkHTTP {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestSinkOptions(t *testing.T) {
+	cases := map[string]SinkOptions{
+		"backpressure": {Type: SinkStdout, Backpressure: "wait"},
+		"file path":    {Type: SinkFile},
+		"rotation":     {Type: SinkFile, Path: "./logs/requests.log", Rotation: Hourly},
+		"bad rotation": {Type: SinkFile, Path: "./logs/{YYYY}.log", Rotation: "weekly"},
+		"http url":     {Type: SinkHTTP},
+		"bus topic":    {Type: SinkBus},
+		"unknown type": {Type: "kafka"},
+	}
+	for name, s := range cases {
+		s.defaults()
+		if err := s.validate(); err == nil {
+			t.Errorf("%s expected an error", name)
+		}
+	}
+
+	s := SinkOptions{Type: SinkFile, Path: "./logs/{YYYY}{MM}{DD}.log", Rotation: Daily}
+	s.defaults()
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != SinkFile || s.BufferSize != 1024 || s.BatchSize != 100 || s.Backpressure != Drop {
+		t.Errorf("unexpected defaults %+v", s)
+	}
+}
+
+// memWriter records the lines written to a file
+type memWriter struct {
+	path   string
+	lines  []string
+	closed bool
+}
+
+func (w *memWriter) WriteLine(b []byte) error { w.lines = append(w.lines, string(b)); return nil }
+func (w *memWriter) Close() error             { w.closed = true; return nil }
+
+func TestFileSinkRotation(t *testing.T) {
+	var files []*memWriter
+	prev := newWriter
+	defer func() { newWriter = prev }()
+	newWriter = func(path string, _ *file.Options) (lineWriter, error) {
+		w := &memWriter{path: path}
+		files = append(files, w)
+		return w, nil
+	}
+
+	s, err := newFileSink("./logs/{YYYY}-{MM}-{DD}T{HH}.log", Hourly, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 10, 17, 9, 15, 0, 0, time.UTC)
+	for _, now := range []time.Time{start, start.Add(30 * time.Minute), start.Add(time.Hour)} {
+		if err := s.rotate(now); err != nil {
+			t.Fatal(err)
+		}
+		s.w.WriteLine([]byte(now.Format(time.Kitchen)))
+	}
+	s.Close()
+
+	// the first file was opened by newFileSink for the current hour
+	files = files[1:]
+	if len(files) != 2 {
+		t.Fatalf("expected a file for each hour, got %d", len(files))
+	}
+	if files[0].path != "./logs/2026-10-17T09.log" || files[1].path != "./logs/2026-10-17T10.log" {
+		t.Errorf("unexpected paths %s %s", files[0].path, files[1].path)
+	}
+	if strings.Join(files[0].lines, ",") != "9:15AM,9:45AM" || strings.Join(files[1].lines, ",") != "10:15AM" {
+		t.Errorf("unexpected lines %v %v", files[0].lines, files[1].lines)
+	}
+	if !files[0].closed || !files[1].closed {
+		t.Error("expected the rotated and last files to be closed")
+	}
+
+	if periodStart(Daily, start.Add(20*time.Hour)) != time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC) {
+		t.Error("expected the daily period to start at midnight")
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	status := http.StatusAccepted
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("expected ndjson, got %s", r.Header.Get("Content-Type"))
+		}
+		sc := bufio.NewScanner(r.Body)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	s := newHTTPSink(srv.URL, time.Second)
+	if err := s.Write([][]byte{[]byte(`{"id":1}`), []byte(`{"id":2}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(lines, ",") != `{"id":1},{"id":2}` {
+		t.Errorf("expected a line per record, got %q", lines)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := s.Write([][]byte{[]byte(`{"id":3}`)}); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected the collector error, got %v", err)
+	}
+	s.Close()
+}
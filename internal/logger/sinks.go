@@ -0,0 +1,197 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pcelvng/task-tools/bus"
+	"github.com/pcelvng/task-tools/file"
+)
+
+// Rotation values for the file sink
+const (
+	Hourly = "hourly"
+	Daily  = "daily"
+)
+
+// lineWriter is the part of a task-tools file.Writer used by the file sink
+type lineWriter interface {
+	WriteLine(b []byte) error
+	Close() error
+}
+
+// newWriter opens the file sink's writer
+var newWriter = func(path string, opts *file.Options) (lineWriter, error) {
+	return file.NewWriter(path, opts)
+}
+
+// fileSink writes records with a task-tools file writer, local or remote (s3, gcs),
+// the file is closed and a new one started when the rotation period changes
+type fileSink struct {
+	path     string
+	rotation string
+	opts     *file.Options
+	period   time.Time
+	w        lineWriter
+}
+
+func newFileSink(path, rotation string, opts *file.Options) (*fileSink, error) {
+	s := &fileSink{path: path, rotation: rotation, opts: opts}
+	if err := s.rotate(time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// validRotation checks the rotation and that a rotated path has a time template
+// so each period is written to its own file
+func validRotation(rotation, path string) error {
+	switch rotation {
+	case "":
+		return nil
+	case Hourly, Daily:
+		if !strings.Contains(path, "{") {
+			return fmt.Errorf("%s rotation needs a time template i.e., {YYYY}{MM}{DD}{HH} in %q", rotation, path)
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid rotation %q, use hourly or daily", rotation)
+}
+
+// periodStart is the start of the rotation period for t
+func periodStart(rotation string, t time.Time) time.Time {
+	switch rotation {
+	case Hourly:
+		return t.Truncate(time.Hour)
+	case Daily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}
+}
+
+// timePath replaces the {YYYY}, {MM}, {DD} and {HH} templates in the path
+func timePath(path string, t time.Time) string {
+	return strings.NewReplacer(
+		"{YYYY}", t.Format("2006"),
+		"{MM}", t.Format("01"),
+		"{DD}", t.Format("02"),
+		"{HH}", t.Format("15"),
+	).Replace(path)
+}
+
+// rotate opens a new file when the period has changed, the previous file is closed
+func (s *fileSink) rotate(now time.Time) error {
+	p := periodStart(s.rotation, now)
+	if s.w != nil && p.Equal(s.period) {
+		return nil
+	}
+	if s.w != nil {
+		if err := s.w.Close(); err != nil {
+			return fmt.Errorf("could not close log file %w", err)
+		}
+		s.w = nil
+	}
+	w, err := newWriter(timePath(s.path, now), s.opts)
+	if err != nil {
+		return fmt.Errorf("could not create log file writer %w", err)
+	}
+	s.w, s.period = w, p
+	return nil
+}
+
+func (s *fileSink) Write(records [][]byte) error {
+	if err := s.rotate(time.Now().UTC()); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := s.w.WriteLine(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	if s.w == nil {
+		return nil
+	}
+	return s.w.Close()
+}
+
+// stdoutSink writes each record as a line to stdout
+type stdoutSink struct{}
+
+func (stdoutSink) Write(records [][]byte) error {
+	var buf bytes.Buffer
+	for _, rec := range records {
+		buf.Write(rec)
+		buf.WriteByte('\n')
+	}
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+func (stdoutSink) Close() error { return nil }
+
+// httpSink posts each batch to a collector as newline delimited json
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPSink(url string, timeout time.Duration) *httpSink {
+	return &httpSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (s *httpSink) Write(records [][]byte) error {
+	body := bytes.Join(records, []byte("\n"))
+	resp, err := s.client.Post(s.url, "application/x-ndjson", bytes.NewReader(append(body, '\n')))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// busSink sends each record as a message with a task-tools producer (nsq, pubsub, file, etc...)
+type busSink struct {
+	topic    string
+	producer bus.Producer
+}
+
+func newBusSink(topic string, opts *bus.Options) (*busSink, error) {
+	p, err := bus.NewProducer(opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not create bus producer %w", err)
+	}
+	if p == nil {
+		return nil, errors.New("bus producer is nil")
+	}
+	return &busSink{topic: topic, producer: p}, nil
+}
+
+func (s *busSink) Write(records [][]byte) error {
+	for _, rec := range records {
+		if err := s.producer.Send(s.topic, rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *busSink) Close() error {
+	return s.producer.Stop()
+}
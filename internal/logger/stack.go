@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// captureStack is set when Debug is on
+var captureStack bool
+
+// Stack returns the caller's stack when Debug is on and an empty string otherwise,
+// skip leaves out that many frames starting with the caller
+func Stack(skip int) string {
+	if !captureStack {
+		return ""
+	}
+
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	for {
+		f, more := frames.Next()
+		if strings.HasPrefix(f.Function, "runtime.") {
+			break
+		}
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// PanicStack returns the goroutine's stack for a recovered panic when Debug is on
+// and an empty string otherwise, it must be called in the deferred func that recovered
+func PanicStack() string {
+	if !captureStack {
+		return ""
+	}
+	return string(debug.Stack())
+}
@@ -0,0 +1,34 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"fmt"
+	"log/syslog"
+)
+
+// syslogSink writes each record as an info message
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink(network, address, tag string) (*syslogSink, error) {
+	w, err := syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to syslog %w", err)
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Write(records [][]byte) error {
+	for _, rec := range records {
+		if err := s.w.Info(string(rec)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,92 @@
+// Package metrics records prometheus request metrics from the request logger
+// and serves them in the prometheus text format
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rest-api/internal/logger"
+)
+
+const namespace = "rest_api"
+
+// unmatched is the route label for requests that didn't match a route, raw uris
+// and unknown methods aren't used as labels to keep the number of series bounded
+const unmatched = "unmatched"
+
+var labels = []string{"route", "method", "status"}
+
+// Registry holds the api's metrics, route packages can register their own collectors
+var Registry = prometheus.NewRegistry()
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of http requests.",
+	}, labels)
+
+	latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of http requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, labels)
+
+	respSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_response_size_bytes",
+		Help:      "Size of http response bodies.",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 8), // 64B to 1MB
+	}, labels)
+
+	inFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "Number of http requests being served.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		requests, latency, respSize, inFlight,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Recorder implements logger.Observer to record the request metrics
+type Recorder struct{}
+
+func (Recorder) Start(_ *http.Request) {
+	inFlight.Inc()
+}
+
+func (Recorder) Finish(l *logger.Log) {
+	inFlight.Dec()
+
+	route := l.Route
+	if route == "" {
+		route = unmatched
+	}
+	lv := []string{route, logger.KnownMethod(l.Method), strconv.Itoa(l.RespCode)}
+	requests.WithLabelValues(lv...).Inc()
+	latency.WithLabelValues(lv...).Observe(l.Latency)
+	respSize.WithLabelValues(lv...).Observe(float64(l.RespSize))
+}
+
+// Handler serves the metrics in the prometheus text format,
+// requests for the metrics are not written to the request log
+func Handler() http.Handler {
+	h := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if req, ok := r.Context().Value(logger.RequestKey).(*logger.Log); ok {
+			req.NoLog = true
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/rest-api/internal/logger"
+)
+
+// seriesLabels returns the label values of the requests_total series
+func seriesLabels(t *testing.T) []map[string]string {
+	t.Helper()
+	mfs, err := Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var series []map[string]string
+	for _, mf := range mfs {
+		if mf.GetName() != namespace+"_http_requests_total" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			lv := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				lv[l.GetName()] = l.GetValue()
+			}
+			series = append(series, lv)
+		}
+	}
+	return series
+}
+
+func TestRecorderLabels(t *testing.T) {
+	requests.Reset()
+	rec := Recorder{}
+	for _, m := range []string{"FOO", "BAR", "get", "GET", "DELETE"} {
+		rec.Start(nil)
+		rec.Finish(&logger.Log{Method: m, RespCode: 405})
+	}
+	rec.Start(nil)
+	rec.Finish(&logger.Log{Method: "GET", Route: "/v1/kittns/{id}", RespCode: 200})
+
+	want := map[string]bool{
+		"unmatched OTHER 405":     true,
+		"unmatched GET 405":       true,
+		"unmatched DELETE 405":    true,
+		"/v1/kittns/{id} GET 200": true,
+	}
+	series := seriesLabels(t)
+	if len(series) != len(want) {
+		t.Fatalf("expected %d series, got %v", len(want), series)
+	}
+	for _, lv := range series {
+		if key := lv["route"] + " " + lv["method"] + " " + lv["status"]; !want[key] {
+			t.Errorf("unexpected series %s", key)
+		}
+	}
+}
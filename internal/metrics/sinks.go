@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rest-api/internal/logger"
+)
+
+var (
+	sinkWritten = prometheus.NewDesc(prometheus.BuildFQName(namespace, "log_sink", "records_written_total"),
+		"Number of request log records written by the sink.", []string{"sink", "type"}, nil)
+	sinkDropped = prometheus.NewDesc(prometheus.BuildFQName(namespace, "log_sink", "records_dropped_total"),
+		"Number of request log records dropped because the sink's queue was full.", []string{"sink", "type"}, nil)
+	sinkFailed = prometheus.NewDesc(prometheus.BuildFQName(namespace, "log_sink", "records_failed_total"),
+		"Number of request log records the sink failed to write.", []string{"sink", "type"}, nil)
+	sinkQueued = prometheus.NewDesc(prometheus.BuildFQName(namespace, "log_sink", "records_queued"),
+		"Number of request log records waiting to be written by the sink.", []string{"sink", "type"}, nil)
+)
+
+// sinkCollector reports the request log sink counters when the metrics are scraped
+type sinkCollector func() []logger.SinkStat
+
+func (c sinkCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sinkWritten
+	ch <- sinkDropped
+	ch <- sinkFailed
+	ch <- sinkQueued
+}
+
+func (c sinkCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c() {
+		ch <- prometheus.MustNewConstMetric(sinkWritten, prometheus.CounterValue, float64(s.Written), s.Name, s.Type)
+		ch <- prometheus.MustNewConstMetric(sinkDropped, prometheus.CounterValue, float64(s.Dropped), s.Name, s.Type)
+		ch <- prometheus.MustNewConstMetric(sinkFailed, prometheus.CounterValue, float64(s.Failed), s.Name, s.Type)
+		ch <- prometheus.MustNewConstMetric(sinkQueued, prometheus.GaugeValue, float64(s.Queued), s.Name, s.Type)
+	}
+}
+
+// ObserveSinks registers the request log sink metrics,
+// stats is usually the logger.Options SinkStats method
+func ObserveSinks(stats func() []logger.SinkStat) {
+	Registry.MustRegister(sinkCollector(stats))
+}
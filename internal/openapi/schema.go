@@ -0,0 +1,244 @@
+package openapi
+
+import (
+	"encoding"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rest-api/internal/validation"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Schemas builds openapi schemas from go types, named struct types
+// are added once to the components and referenced by every endpoint that uses them
+type Schemas struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+}
+
+func NewSchemas() *Schemas {
+	return &Schemas{
+		components: make(map[string]*Schema),
+		names:      make(map[reflect.Type]string),
+	}
+}
+
+// Components returns the shared schemas for the components section
+func (s *Schemas) Components() map[string]*Schema {
+	return s.components
+}
+
+// Of returns the schema for the type of the example value v
+func (s *Schemas) Of(v any) *Schema {
+	if v == nil {
+		return nil
+	}
+	return s.schema(reflect.TypeOf(v))
+}
+
+func (s *Schemas) schema(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Pointer {
+		sc := s.schema(t.Elem())
+		if sc.Ref != "" {
+			return sc // siblings of a $ref are ignored in openapi 3.0
+		}
+		sc.Nullable = true
+		return sc
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() != reflect.Struct && t.Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		return s.ref(t)
+	}
+
+	// interfaces (any) can hold any value
+	return &Schema{}
+}
+
+// ref adds the named struct to the components and returns a reference to it
+func (s *Schemas) ref(t reflect.Type) *Schema {
+	name, found := s.names[t]
+	if !found {
+		name = s.componentName(t)
+		s.names[t] = name
+		s.components[name] = &Schema{} // placeholder for recursive types
+		*s.components[name] = *s.object(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+var typeArgPath = regexp.MustCompile(`[\w.\-]+/`)
+
+// componentName is the type name, prefixed with the package name
+// when another type already uses that name
+func (s *Schemas) componentName(t reflect.Type) string {
+	clean := func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}
+	// the type args of generic types are named without their package path i.e., Page[kittns.Kitten]
+	name := strings.Trim(strings.Map(clean, typeArgPath.ReplaceAllString(t.Name(), "")), "_")
+	if _, used := s.components[name]; !used {
+		return name
+	}
+
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	name = strings.Map(clean, pkg) + "." + name
+	for i := 2; ; i++ {
+		if _, used := s.components[name]; !used {
+			return name
+		}
+		name = strings.TrimRight(name, "0123456789") + strconv.Itoa(i)
+	}
+}
+
+// object builds a struct schema using the json tag names,
+// fields without omitempty are listed as required
+func (s *Schemas) object(t reflect.Type) *Schema {
+	sc := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, omitempty := JSONName(sf)
+		if name == "-" {
+			continue
+		}
+
+		// embedded structs without a json name are flattened into the parent
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && sf.Tag.Get("json") == "" && ft.Kind() == reflect.Struct {
+			embedded := s.object(ft)
+			for k, v := range embedded.Properties {
+				sc.Properties[k] = v
+			}
+			sc.Required = append(sc.Required, embedded.Required...)
+			continue
+		}
+
+		prop := s.schema(sf.Type)
+		required := !omitempty && sf.Type.Kind() != reflect.Pointer
+		if tag := sf.Tag.Get(validation.Tag); tag != "" {
+			if prop.Ref != "" {
+				// a $ref can't have sibling keywords in openapi 3.0
+				rules, _ := validation.Parse(tag)
+				required = required || rules.Required()
+			} else {
+				required = ApplyRules(prop, tag) || required
+			}
+		}
+
+		sc.Properties[name] = prop
+		if required {
+			sc.Required = append(sc.Required, name)
+		}
+	}
+
+	return sc
+}
+
+// JSONName returns the json field name and if the field is omitempty
+func JSONName(sf reflect.StructField) (name string, omitempty bool) {
+	tag := sf.Tag.Get("json")
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = sf.Name
+	}
+	return name, strings.Contains(opts, "omitempty")
+}
+
+// ApplyRules adds the validate tag rules to the schema, returns true when the field
+// has the required rule. Tags that don't parse are reported when the routes are validated
+func ApplyRules(sc *Schema, tag string) (required bool) {
+	rules, _ := validation.Parse(tag)
+	for _, r := range rules {
+		switch r.Key {
+		case "required":
+			required = true
+		case "min", "max":
+			f := r.Num
+			if r.Key == "min" {
+				sc.Minimum = &f
+			} else {
+				sc.Maximum = &f
+			}
+		case "len", "minlen", "maxlen":
+			n := r.Len
+			lower, upper := r.Key != "maxlen", r.Key != "minlen"
+			if sc.Type == "array" {
+				if lower {
+					sc.MinItems = &n
+				}
+				if upper {
+					sc.MaxItems = &n
+				}
+			} else {
+				if lower {
+					sc.MinLength = &n
+				}
+				if upper {
+					sc.MaxLength = &n
+				}
+			}
+		case "enum":
+			for _, o := range r.Enum {
+				if f, err := strconv.ParseFloat(o, 64); err == nil && (sc.Type == "integer" || sc.Type == "number") {
+					sc.Enum = append(sc.Enum, f)
+				} else {
+					sc.Enum = append(sc.Enum, o)
+				}
+			}
+		case "regex":
+			sc.Pattern = r.Arg
+		}
+	}
+
+	return required
+}
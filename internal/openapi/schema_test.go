@@ -0,0 +1,135 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type toy struct {
+	Kind string `json:"kind" validate:"enum=ball|mouse"`
+}
+
+type owner struct {
+	Name string `json:"name"`
+}
+
+type Base struct {
+	ID int64 `json:"id,omitempty"`
+}
+
+type cat struct {
+	Base
+	Name    string            `json:"name" validate:"required,minlen=1,maxlen=50"`
+	Nick    string            `json:"nick,omitempty"`
+	Cute    int               `json:"cute" validate:"min=0,max=10,enum=1|5|10"`
+	Born    time.Time         `json:"born"`
+	Toys    []toy             `json:"toys" validate:"maxlen=3"`
+	Owner   *owner            `json:"owner" validate:"required"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Photo   []byte            `json:"photo,omitempty"`
+	Extra   any               `json:"extra,omitempty"`
+	Breed   string            `json:"breed" validate:"regex=^[a-z]+$"`
+	private string
+	Skip    string `json:"-"`
+}
+
+func TestSchemas(t *testing.T) {
+	s := NewSchemas()
+	ref := s.Of(cat{})
+	if ref.Ref != "#/components/schemas/cat" {
+		t.Fatalf("expected a reference to cat, got %+v", ref)
+	}
+	if s.Of(&cat{}).Ref != ref.Ref {
+		t.Error("expected a pointer to use the same component")
+	}
+
+	c := s.Components()["cat"]
+	if c == nil || c.Type != "object" {
+		t.Fatalf("expected the cat component, got %v", s.Components())
+	}
+	names := make([]string, 0, len(c.Properties))
+	for n := range c.Properties {
+		names = append(names, n)
+	}
+	for _, n := range []string{"private", "Skip", "-", "Base"} {
+		if _, found := c.Properties[n]; found {
+			t.Errorf("%s shouldn't be a property %v", n, names)
+		}
+	}
+
+	wantRequired := []string{"name", "cute", "born", "toys", "owner", "breed"}
+	if !reflect.DeepEqual(c.Required, wantRequired) {
+		t.Errorf("expected required %v, got %v", wantRequired, c.Required)
+	}
+
+	p := c.Properties
+	if p["id"].Type != "integer" || p["id"].Format != "int64" {
+		t.Errorf("expected the embedded id, got %+v", p["id"])
+	}
+	if *p["name"].MinLength != 1 || *p["name"].MaxLength != 50 {
+		t.Errorf("expected the name length rules, got %+v", p["name"])
+	}
+	if *p["cute"].Minimum != 0 || *p["cute"].Maximum != 10 || !reflect.DeepEqual(p["cute"].Enum, []any{1.0, 5.0, 10.0}) {
+		t.Errorf("expected the cute rules, got %+v", p["cute"])
+	}
+	if p["born"].Format != "date-time" || p["photo"].Format != "byte" || p["tags"].AdditionalProperties.Type != "string" {
+		t.Errorf("unexpected formats %+v %+v %+v", p["born"], p["photo"], p["tags"])
+	}
+	if p["toys"].Type != "array" || *p["toys"].MaxItems != 3 || p["toys"].Items.Ref != "#/components/schemas/toy" {
+		t.Errorf("expected an array of toys, got %+v", p["toys"])
+	}
+	if p["owner"].Ref != "#/components/schemas/owner" || p["owner"].Nullable {
+		t.Errorf("expected a plain owner reference, got %+v", p["owner"])
+	}
+	if p["breed"].Pattern != "^[a-z]+$" || !reflect.DeepEqual(*p["extra"], Schema{}) {
+		t.Errorf("unexpected breed or extra %+v %+v", p["breed"], p["extra"])
+	}
+	if e := s.Components()["toy"].Properties["kind"].Enum; !reflect.DeepEqual(e, []any{"ball", "mouse"}) {
+		t.Errorf("expected the string enum, got %v", e)
+	}
+}
+
+type node struct {
+	Value    int     `json:"value"`
+	Children []*node `json:"children"`
+}
+
+func TestRecursive(t *testing.T) {
+	s := NewSchemas()
+	s.Of(node{})
+	n := s.Components()["node"]
+	if n == nil || n.Properties["children"].Items.Ref != "#/components/schemas/node" {
+		t.Errorf("expected the children to reference node, got %+v", n)
+	}
+}
+
+type Page[T any] struct {
+	Data []T `json:"data"`
+}
+
+func TestComponentName(t *testing.T) {
+	s := NewSchemas()
+	s.Of(Page[toy]{})
+	if _, found := s.Components()["Page_openapi.toy"]; !found {
+		t.Errorf("expected the generic name without the package path, got %v", s.Components())
+	}
+
+	// a type with a name that's already used gets the package prefix
+	s = NewSchemas()
+	s.components["toy"] = &Schema{}
+	if ref := s.Of(toy{}).Ref; ref != "#/components/schemas/openapi.toy" {
+		t.Errorf("expected the package prefix, got %s", ref)
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	sc := &Schema{Type: "string"}
+	if !ApplyRules(sc, "required,len=4") || *sc.MinLength != 4 || *sc.MaxLength != 4 {
+		t.Errorf("expected required with the exact length, got %+v", sc)
+	}
+	sc = &Schema{Type: "integer"}
+	if ApplyRules(sc, "min=1,max=5") || *sc.Minimum != 1 || *sc.Maximum != 5 {
+		t.Errorf("expected separate min and max, got %+v", sc)
+	}
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how often idle buckets are removed from the MemoryStore
+const sweepEvery = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // when the bucket will be full again
+}
+
+// MemoryStore keeps the token buckets in memory, limits are per instance
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+// Take refills the bucket for the time since it was last used and takes a token
+func (m *MemoryStore) Take(_ context.Context, key string, p Policy, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.swept) > sweepEvery {
+		m.sweep(now)
+	}
+
+	capacity, rate := p.capacity(), p.rate()
+	b, found := m.buckets[key]
+	if !found {
+		b = &bucket{tokens: capacity, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := Result{Limit: int(capacity)}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - b.tokens) / rate * float64(time.Second))
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = time.Duration((capacity - b.tokens) / rate * float64(time.Second))
+	b.full = now.Add(res.Reset)
+
+	return res, nil
+}
+
+// sweep removes the buckets that have refilled, they are the same as a new bucket
+func (m *MemoryStore) sweep(now time.Time) {
+	for k, b := range m.buckets {
+		if now.After(b.full) {
+			delete(m.buckets, k)
+		}
+	}
+	m.swept = now
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	m := NewMemoryStore()
+	p := Policy{Limit: 2, Window: time.Second}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		res, _ := m.Take(context.Background(), "k", p, now)
+		if !res.Allowed || res.Remaining != 1-i {
+			t.Fatalf("take %d expected allowed with %d remaining, got %+v", i, 1-i, res)
+		}
+	}
+
+	res, _ := m.Take(context.Background(), "k", p, now)
+	if res.Allowed {
+		t.Fatalf("expected the empty bucket to deny, got %+v", res)
+	}
+	if res.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected a retry after one token (500ms), got %v", res.RetryAfter)
+	}
+
+	// half a window refills one token
+	res, _ = m.Take(context.Background(), "k", p, now.Add(500*time.Millisecond))
+	if !res.Allowed {
+		t.Errorf("expected the refilled token to be allowed, got %+v", res)
+	}
+
+	// other keys have their own bucket
+	if res, _ = m.Take(context.Background(), "other", p, now); !res.Allowed {
+		t.Errorf("expected a new bucket to be allowed, got %+v", res)
+	}
+}
+
+func TestMemoryStoreBurst(t *testing.T) {
+	m := NewMemoryStore()
+	p := Policy{Limit: 10, Window: time.Minute, Burst: 3}
+	now := time.Now()
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		res, _ := m.Take(context.Background(), "k", p, now)
+		if res.Limit != 3 {
+			t.Fatalf("expected the limit to be the burst 3, got %d", res.Limit)
+		}
+		if res.Allowed {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("expected the burst of 3 requests, got %d", allowed)
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	m := NewMemoryStore()
+	p := Policy{Limit: 1, Window: time.Second}
+	now := time.Now()
+
+	m.Take(context.Background(), "k", p, now)
+	m.Take(context.Background(), "new", p, now.Add(2*sweepEvery))
+	if _, found := m.buckets["k"]; found {
+		t.Error("expected the refilled bucket to be swept")
+	}
+}
@@ -0,0 +1,129 @@
+// Package ratelimit limits requests with token buckets keyed by the client ip,
+// api key or authenticated principal. Buckets are kept in a Store,
+// an in-memory store is used unless another one is set with SetStore
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rest-api/internal/auth"
+)
+
+// KeyBy selects what a request's bucket is keyed on
+type KeyBy string
+
+const (
+	IP        KeyBy = "ip"        // the client's remote address (default)
+	APIKey    KeyBy = "api_key"   // the validated api key's subject, falls back to the ip
+	Principal KeyBy = "principal" // the authenticated principal, falls back to the ip
+)
+
+// Valid returns true for a known KeyBy, empty defaults to the ip
+func (k KeyBy) Valid() bool {
+	switch k {
+	case "", IP, APIKey, Principal:
+		return true
+	}
+	return false
+}
+
+// Policy is a token bucket that refills Limit tokens every Window,
+// up to Burst tokens can be used at once (default Limit). A zero Limit disables the policy
+type Policy struct {
+	Limit  int           `toml:"limit" json:"limit" comment:"number of requests allowed per window (0 disables rate limiting)"`
+	Window time.Duration `toml:"window" json:"window" comment:"the window the limit applies to i.e., 1m"`
+	Burst  int           `toml:"burst" json:"burst" comment:"max requests allowed at once (default limit)"`
+	KeyBy  KeyBy         `toml:"key_by" json:"key_by" comment:"limit requests by ip, api_key or principal (default ip)"`
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Limit      int // the bucket's capacity, the Burst when it's set
+	Remaining  int
+	Reset      time.Duration // time until the bucket is full
+	RetryAfter time.Duration // time until the next token when not allowed
+}
+
+// Store keeps the token buckets, implementations must be safe for concurrent use
+type Store interface {
+	Take(ctx context.Context, key string, p Policy, now time.Time) (Result, error)
+}
+
+var store Store = NewMemoryStore()
+
+// SetStore replaces the store used for all policies i.e., with a shared redis store
+func SetStore(s Store) {
+	store = s
+}
+
+// Enabled returns true when the policy limits requests
+func (p *Policy) Enabled() bool {
+	return p != nil && p.Limit > 0 && p.Window > 0
+}
+
+// capacity is the max number of tokens in the bucket
+func (p Policy) capacity() float64 {
+	if p.Burst > 0 {
+		return float64(p.Burst)
+	}
+	return float64(p.Limit)
+}
+
+// rate is the number of tokens added each second
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Window.Seconds()
+}
+
+// Take takes a token from the request's bucket, scope separates
+// the buckets of policies that share a key i.e., the endpoint path
+func Take(r *http.Request, scope string, p Policy, pr *auth.Principal) (Result, error) {
+	return store.Take(r.Context(), scope+"|"+Key(r, p.KeyBy, pr), p, time.Now())
+}
+
+// AfterAuth returns true when the requests are counted after they're authenticated,
+// the credentials aren't used for the key until they have been validated
+func (k KeyBy) AfterAuth() bool {
+	return k == Principal || k == APIKey
+}
+
+// Key returns the bucket key for the request, the principal is the
+// authenticated principal and the ip is used when it's nil
+func Key(r *http.Request, by KeyBy, p *auth.Principal) string {
+	switch by {
+	case Principal:
+		if p != nil {
+			return "principal:" + string(p.Method) + ":" + p.Subject
+		}
+	case APIKey:
+		if p != nil && p.Method == auth.APIKey {
+			return "api_key:" + p.Subject
+		}
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip:" + ip
+}
+
+// Headers sets the X-RateLimit-* headers, and Retry-After when the request isn't allowed
+func (res Result) Headers(h http.Header) {
+	h.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+	if !res.Allowed {
+		h.Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+	}
+}
+
+// seconds rounds the duration up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
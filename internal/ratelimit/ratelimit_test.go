@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rest-api/internal/auth"
+)
+
+func TestKey(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set(auth.DefaultAPIKeyHeader, "random-key")
+
+	cases := map[string]struct {
+		by   KeyBy
+		p    *auth.Principal
+		want string
+	}{
+		"ip":                   {by: IP, want: "ip:10.0.0.1"},
+		"unvalidated api key":  {by: APIKey, want: "ip:10.0.0.1"},
+		"validated api key":    {by: APIKey, p: &auth.Principal{Method: auth.APIKey, Subject: "reporting"}, want: "api_key:reporting"},
+		"api key other method": {by: APIKey, p: &auth.Principal{Method: auth.Basic, Subject: "alice"}, want: "ip:10.0.0.1"},
+		"principal":            {by: Principal, p: &auth.Principal{Method: auth.Basic, Subject: "alice"}, want: "principal:basic:alice"},
+		"no principal":         {by: Principal, want: "ip:10.0.0.1"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if got := Key(r, c.by, c.p); got != c.want {
+				t.Errorf("expected %s, got %s", c.want, got)
+			}
+		})
+	}
+}
+
+func TestAfterAuth(t *testing.T) {
+	for by, want := range map[KeyBy]bool{"": false, IP: false, APIKey: true, Principal: true} {
+		if got := by.AfterAuth(); got != want {
+			t.Errorf("%q expected %v, got %v", by, want, got)
+		}
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	h := http.Header{}
+	Result{Limit: 5, Remaining: 0, Reset: 1500e6, RetryAfter: 200e6}.Headers(h)
+
+	want := map[string]string{
+		"X-RateLimit-Limit":     "5",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "2",
+		"Retry-After":           "1",
+	}
+	for k, v := range want {
+		if h.Get(k) != v {
+			t.Errorf("%s expected %s, got %q", k, v, h.Get(k))
+		}
+	}
+}
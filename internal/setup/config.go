@@ -1,14 +1,24 @@
 package setup
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"path"
+	"reflect"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/rest-api/db"
+	"github.com/rest-api/internal/auth"
+	"github.com/rest-api/internal/listquery"
 	"github.com/rest-api/internal/logger"
+	"github.com/rest-api/internal/metrics"
+	"github.com/rest-api/internal/ratelimit"
+	"github.com/rest-api/internal/tracing"
+	"github.com/rest-api/internal/validation"
 )
 
 // endpoint groups are sorted by these methods
@@ -29,6 +39,12 @@ const (
 
 const ContentJSON = "application/json"
 
+// error response formats
+const (
+	ErrorJSON    = "json"    // the logger.RespBody message, code and status
+	ErrorProblem = "problem" // RFC 7807 application/problem+json
+)
+
 type Method uint
 type Methods []Method
 
@@ -47,6 +63,31 @@ type Endpoint struct {
 	ResponseBody any     // This is used to generate the api docs JSON object string for the response
 	HandlerFunc  Handler // the Handler function is called when the router matches the endpoint path
 	Pretty       bool    // output the json string as pretty format when true
+	SuccessCode  int     // the http status code used by typed handlers for a successful response (default 200)
+	ErrorFormat  string  // the format of error responses json or problem, the config ErrorFormat is used when empty
+
+	// the auth methods accepted by the endpoint, the first method with valid credentials is used.
+	// The endpoint is public when empty
+	Auth auth.Methods
+	// the scopes or roles the principal must have, requests missing any of them get a 403
+	Scopes []string
+	// the endpoint's rate limit, the global rate limit is used when nil
+	RateLimit *ratelimit.Policy
+	// masks and header capture for the request log, merged with the log options redaction.
+	// Use SkipBody to keep the request body out of the log
+	Redact *logger.Redaction
+	// when the response body is captured in the request log, replaces the log options capture
+	Capture *logger.Capture
+	// the error responses the handler returns with Fail, each one is documented with an example
+	Errors []ErrorResp
+	// the media types typed handlers can write, the ResponseType is the default when any type is accepted.
+	// Every registered encoder that supports the response is used when empty
+	Produces []string
+	// the request body media types typed handlers can read, every registered decoder is used when empty
+	Consumes []string
+	// the paging, sort and filter params of a list endpoint, they're parsed into a listquery.Query
+	// that's bound to the request and added to the QueryParams
+	List *listquery.Spec
 
 	// These are used to define the api documentation
 	Name        string  // (api docs) a simple statement for the endpoint
@@ -59,7 +100,11 @@ type Endpoint struct {
 type Param struct {
 	Name        string
 	Description string
-	Required    bool // a value of yes or no here
+	Required    bool      // a value of yes or no here
+	Type        ParamType // the value type for path and query params (default String)
+	Default     string    // the value used when the query param is not given
+	Enum        []string  // the allowed values for the Enum type
+	Validate    string    // validate rules for the value i.e., "min=1,max=100" (see the validation package)
 }
 
 type Endpoints map[string]Endpoint
@@ -72,15 +117,31 @@ type Handler func(w http.ResponseWriter, r *http.Request) error
 
 type Key string
 type Config struct {
-	Port      int             `toml:"port" json:"port" flag:"port" comment:"http port number"`
-	Debug     bool            `toml:"debug" json:"debug" flag:"debug" comment:"show debug logging"`
-	Log       *logger.Options `toml:"log_options" json:"log_options"`
-	ColorLog  bool            `flag:"color" toml:"color" json:"color" comment:"use linux coloring for request logs"`
-	PrettyLog bool            `toml:"pretty_log" flag:"pretty" comment:"will pretty print request logs"`
-	BuildDocs bool            `toml:"build_docs" flag:"docs" comment:"flag to build the swagger api spec for the swagger ui"`
-	SwaggerUI string          `toml:"swagger_ui" flag:"swagger" comment:"the origin name for the swagger ui"`
-	mux       *chi.Mux
-	Routes    Endpoints
+	Port      int               `toml:"port" json:"port" flag:"port" comment:"http port number"`
+	Debug     bool              `toml:"debug" json:"debug" flag:"debug" comment:"show debug logging"`
+	Log       *logger.Options   `toml:"log_options" json:"log_options"`
+	DB        *db.Options       `toml:"db_options" json:"db_options"`
+	Auth      *auth.Options     `toml:"auth_options" json:"auth_options"`
+	RateLimit *ratelimit.Policy `toml:"rate_limit" json:"rate_limit"`
+	Tracing   *tracing.Options  `toml:"tracing" json:"tracing"`
+	ColorLog  bool              `flag:"color" toml:"color" json:"color" comment:"use linux coloring for request logs"`
+	PrettyLog bool              `toml:"pretty_log" flag:"pretty" comment:"will pretty print request logs"`
+	BuildDocs bool              `toml:"build_docs" flag:"docs" comment:"flag to write the openapi spec to openapi.json"`
+	SwaggerUI string            `toml:"swagger_ui" flag:"swagger" comment:"the origin for an external swagger ui i.e., http://swagger_ui:8080 (the embedded ui is used when empty)"`
+	Migrate   bool              `toml:"migrate" flag:"migrate" comment:"apply pending db migrations and exit"`
+	Rollback  int               `toml:"rollback" flag:"rollback" comment:"number of db migrations to roll back with -migrate"`
+	DryRun    bool              `toml:"dry_run" flag:"dry-run" comment:"print pending migration statements with -migrate without applying them"`
+
+	ErrorFormat string `toml:"error_format" json:"error_format" comment:"error response format json or problem (RFC 7807 application/problem+json)"`
+
+	ReadTimeout     time.Duration `toml:"read_timeout" flag:"read-timeout" comment:"max duration for reading the entire request"`
+	WriteTimeout    time.Duration `toml:"write_timeout" flag:"write-timeout" comment:"max duration before timing out writes of the response"`
+	IdleTimeout     time.Duration `toml:"idle_timeout" flag:"idle-timeout" comment:"max time to wait for the next request on keep-alive connections"`
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout" flag:"shutdown-timeout" comment:"drain period for in-flight requests during a graceful shutdown"`
+	ShutdownDelay   time.Duration `toml:"shutdown_delay" flag:"shutdown-delay" comment:"time to keep serving with a failing readiness probe before draining"`
+
+	mux    *chi.Mux
+	Routes Endpoints
 }
 
 var apiConfig *Config
@@ -119,55 +180,171 @@ func (rm Method) String() string {
 }
 
 // InitConifg sets up the internal configuration for the api
-func InitConfig(c *Config) {
+func InitConfig(c *Config) error {
 	if c == nil {
-		log.Fatal("given config is nil")
+		return errors.New("given config is nil")
 	}
 	apiConfig = c
 
-	if apiConfig.Debug {
-		log.Println("debug flag enabled")
-	}
+	slog.Debug("debug flag enabled")
 
 	apiConfig.mux = chi.NewRouter()
+	return nil
 }
 
 // ServeHTTP is the wrapper method for the http.HandlerFunc
-// this is for marshaling the error handling
+// this is for marshaling the error handling, errors use the global ErrorFormat
 func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var respBody []byte
+	h.serve(w, r, errorFormat(""))
+}
+
+// serve calls the handler and writes a returned error in the error format,
+// a panic in the handler is written as a 500 error with the panic in the request log
+func (h Handler) serve(w http.ResponseWriter, r *http.Request, format string) {
 	req := r.Context().Value(logger.RequestKey).(*logger.Log)
+	sw := &sentWriter{ResponseWriter: w}
 
-	if err := h(w, r); err != nil {
-		a, ok := err.(*logger.APIErr)
-		if !ok {
-			a = &logger.APIErr{
-				Internal: logger.Internal{
-					Msg:     "handler error",
-					Err:     err,
-					ErrText: err.Error(),
-				},
-				RespBody: logger.RespBody{
-					Msg:  "an error has occured, please see request id: " + req.ID,
-					Code: http.StatusInternalServerError,
-				},
-			}
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		}
+		if p == http.ErrAbortHandler {
+			panic(p) // the server aborts the response without logging a stack
+		}
+		writeError(sw, req, panicErr(p, req.ID), format)
+	}()
+
+	if err := h(sw, r); err != nil {
+		writeError(sw, req, err, format)
+	}
+}
+
+// sentWriter records when the response has been started
+// so an error isn't written after the handler's headers or body
+type sentWriter struct {
+	http.ResponseWriter
+	sent bool
+}
+
+func (w *sentWriter) WriteHeader(code int) {
+	w.sent = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *sentWriter) Write(b []byte) (int, error) {
+	w.sent = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sentWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.sent = true
+		f.Flush()
+	}
+}
+
+// Unwrap returns the writer for http.ResponseController
+func (w *sentWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// writeError records the error on the request log and writes it in the error format,
+// when the response has already been started the error is only recorded
+func writeError(w *sentWriter, req *logger.Log, err error, format string) {
+	var a *logger.APIErr
+	if errors.As(err, &a) {
+		// copy the error so an APIErr shared between requests isn't changed
+		wrapped := err != error(a)
+		ae := *a
+		a = &ae
+		if wrapped && a.ErrText == "" {
+			a.ErrText = err.Error()
 		}
+	} else {
+		a = &logger.APIErr{
+			Internal: logger.Internal{
+				Msg:     "handler error",
+				Err:     err,
+				ErrText: err.Error(),
+			},
+			RespBody: logger.RespBody{
+				Msg:  "an error has occured, please see request id: " + req.ID,
+				Code: http.StatusInternalServerError,
+			},
+		}
+	}
+	req.APIError = &a.Internal
+	if w.sent {
+		return
+	}
 
-		a.Status = http.StatusText(a.Code)
+	var respBody []byte
+	a.Status = http.StatusText(a.Code)
+	contentType := ContentJSON
+	if format == ErrorProblem {
+		contentType = logger.ContentProblem
+		respBody, _ = json.Marshal(a.Problem(req.ID))
+	} else {
 		respBody, _ = json.Marshal(a.RespBody)
-		req.APIError = &a.Internal
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(a.Code)
+	w.Write(respBody)
+}
 
-		w.Header().Set("Content-Type", ContentJSON)
-		w.WriteHeader(a.Code)
-		w.Write(respBody)
+// panicErr converts a recovered panic into a 500 APIErr with the stack of the panic when Debug is on
+func panicErr(p any, id string) *logger.APIErr {
+	err, ok := p.(error)
+	if !ok {
+		err = fmt.Errorf("%v", p)
+	}
+	return &logger.APIErr{
+		Internal: logger.Internal{
+			Msg:     "panic recovered",
+			Err:     err,
+			ErrText: fmt.Sprintf("panic: %v", p),
+			Stack:   logger.PanicStack(),
+		},
+		RespBody: logger.RespBody{
+			Msg:  "an error has occured, please see request id: " + id,
+			Code: http.StatusInternalServerError,
+		},
 	}
 }
 
+// Recoverer writes panics from the next handlers as the standard error response in the
+// global ErrorFormat and records the panic on the request log, it must be added after the request logger
+func Recoverer(next http.Handler) http.Handler {
+	return Handler(func(w http.ResponseWriter, r *http.Request) error {
+		next.ServeHTTP(w, r)
+		return nil
+	})
+}
+
+// errorFormat returns the format or the global ErrorFormat when it's empty,
+// json is used when neither is set
+func errorFormat(format string) string {
+	if format == "" && apiConfig != nil {
+		format = apiConfig.ErrorFormat
+	}
+	if format == "" {
+		return ErrorJSON
+	}
+	return format
+}
+
 // validate is to verify that the apiConfig
 // endpoints have been setup correctly
 func validate() error {
+	if f := errorFormat(""); f != ErrorJSON && f != ErrorProblem {
+		return fmt.Errorf("invalid error_format %q, use json or problem", f)
+	}
 	for _, e := range apiConfig.Routes {
+		if f := errorFormat(e.ErrorFormat); f != ErrorJSON && f != ErrorProblem {
+			return fmt.Errorf("invalid error format %q %v (%s)", f, e.Methods, e.FullPath)
+		}
 		if len(e.Path) == 0 || e.Path[:1] != "/" {
 			return fmt.Errorf("the path must start with a forward slash / %s %v (%s)",
 				e.Name, e.Methods, e.Path)
@@ -192,6 +369,55 @@ func validate() error {
 			return fmt.Errorf("params in path do not match URLParams %v %v (%s)",
 				e.PathParams, e.Methods, e.FullPath)
 		}
+		for _, p := range append(e.PathParams, e.QueryParams...) {
+			if p.Type == Enum && len(p.Enum) == 0 {
+				return fmt.Errorf("enum param %s needs Enum values %v (%s)", p.Name, e.Methods, e.FullPath)
+			}
+			if p.Default != "" {
+				if _, err := p.parse(p.Default); err != nil {
+					return fmt.Errorf("invalid default for param %s %v %v (%s)", p.Name, err, e.Methods, e.FullPath)
+				}
+			}
+			if p.Validate != "" {
+				rules, err := validation.Parse(p.Validate)
+				if err == nil {
+					err = rules.CheckType(p.Type.goType())
+				}
+				if err != nil {
+					return fmt.Errorf("invalid validate rules for param %s %w %v (%s)", p.Name, err, e.Methods, e.FullPath)
+				}
+			}
+		}
+		if e.RequestBody != nil {
+			if err := validation.Struct(reflect.TypeOf(e.RequestBody)); err != nil {
+				return fmt.Errorf("invalid validate tag on the request body %w %v (%s)", err, e.Methods, e.FullPath)
+			}
+		}
+		if err := e.Redact.Validate(); err != nil {
+			return fmt.Errorf("%w %v (%s)", err, e.Methods, e.FullPath)
+		}
+		if err := e.Capture.Validate(); err != nil {
+			return fmt.Errorf("%w %v (%s)", err, e.Methods, e.FullPath)
+		}
+		if err := validateErrors(e); err != nil {
+			return err
+		}
+		if err := validateMediaTypes(e); err != nil {
+			return err
+		}
+		if err := e.List.Validate(); err != nil {
+			return fmt.Errorf("%w %v (%s)", err, e.Methods, e.FullPath)
+		}
+		if len(e.Scopes) > 0 && len(e.Auth) == 0 {
+			return fmt.Errorf("scopes need at least one Auth method %v (%s)", e.Methods, e.FullPath)
+		}
+		if p, _ := e.rateLimit(); p.Enabled() && !p.KeyBy.Valid() {
+			return fmt.Errorf("invalid rate limit key_by %q %v (%s)", p.KeyBy, e.Methods, e.FullPath)
+		}
+		if len(e.Auth) > 0 && !authEnabled(e.Auth) {
+			return fmt.Errorf("none of the auth methods %v are configured in auth_options, every request would be rejected %v (%s)",
+				e.Auth, e.Methods, e.FullPath)
+		}
 		if e.RequestBody != nil && len(e.JSONFields) == 0 {
 			return fmt.Errorf("json request fields need to be defined in JSONFields %v (%s)",
 				e.Methods, e.FullPath)
@@ -206,21 +432,23 @@ func validate() error {
 //	endpoints, setting the handler func, path and method
 //
 // This must happen after all middleware has been initialized
-func AddRoutes() {
+func AddRoutes() error {
 	if apiConfig == nil {
-		log.Fatal("config apiConfig is nil")
+		return errors.New("config apiConfig is nil")
 	}
 
 	// validate the added endpoints
-	err := validate()
-	if err != nil {
-		log.Fatalln(err)
+	if err := validate(); err != nil {
+		return err
 	}
 
 	// api documentation file serving
 	apiConfig.mux.Get("/docs", Docs)
 	apiConfig.mux.Get("/docs/*", Docs)
 
+	// prometheus metrics
+	apiConfig.mux.Method(http.MethodGet, "/metrics", metrics.Handler())
+
 	// add the endpoints to the chi mux router
 	for x, e := range apiConfig.Routes {
 		// drop any trailing forward slashes on the path
@@ -237,7 +465,7 @@ func AddRoutes() {
 					method := Method(i).String()
 					if method != "HEAD" && method != "DELETE" {
 						e.Methods = append(e.Methods, Method(i))
-						apiConfig.mux.Method(method, e.FullPath, e.HandlerFunc)
+						apiConfig.mux.Method(method, e.FullPath, e.handler())
 					}
 				}
 				apiConfig.Routes[x] = e
@@ -246,14 +474,14 @@ func AddRoutes() {
 		}
 		if !any {
 			for _, m := range e.Methods {
-				apiConfig.mux.Method(m.String(), e.FullPath, e.HandlerFunc)
+				apiConfig.mux.Method(m.String(), e.FullPath, e.handler())
 			}
 		}
 
-		if apiConfig.Debug {
-			log.Printf("adding route %v path: %s", e.Methods, e.FullPath)
-		}
+		slog.Debug("adding route", "methods", fmt.Sprint(e.Methods), "path", e.FullPath)
 	}
+
+	return nil
 }
 
 // Mux returns the chi.mux (router)
@@ -265,12 +493,18 @@ func Mux() *chi.Mux {
 // a full route is determined by {domain}/{version}/{group}/{endpoint.path}
 // an error is returned if the endpoint has already been created
 func AddEndpoints(ep ...Endpoint) error {
+	if apiConfig == nil {
+		return errors.New("config apiConfig is nil")
+	}
 	for _, e := range ep {
 		e.FullPath = path.Clean("/" + e.Version + "/" + e.Group + e.Path)
+		if e.List != nil {
+			e.QueryParams = append(e.QueryParams[:len(e.QueryParams):len(e.QueryParams)], listParams(e.List)...)
+		}
 		id := fmt.Sprintf("%v %s", e.Methods, e.FullPath)
 		_, found := apiConfig.Routes[id]
 		if found {
-			log.Fatalf("duplicate endpoint (%s) %s", e.FullPath, e.Description)
+			return fmt.Errorf("duplicate endpoint (%s) %s", e.FullPath, e.Description)
 		}
 
 		apiConfig.Routes[id] = e
@@ -294,18 +528,18 @@ func GetRoute(name string) (e Endpoint, found bool) {
 
 var json = jsoniter.ConfigFastest
 
-func (ep Endpoint) MarshalResp() string {
+func (ep Endpoint) MarshalResp() (string, error) {
 	b, err := json.MarshalIndent(ep.ResponseBody, "", " ")
 	if err != nil {
-		log.Fatalf("could not marshal_resp %s", err.Error())
+		return "", fmt.Errorf("could not marshal_resp %w", err)
 	}
-	return string(b)
+	return string(b), nil
 }
 
-func (ep Endpoint) MarshalReq() string {
+func (ep Endpoint) MarshalReq() (string, error) {
 	b, err := json.MarshalIndent(ep.RequestBody, "", " ")
 	if err != nil {
-		log.Fatalf("could not marshal_resp %s", err.Error())
+		return "", fmt.Errorf("could not marshal_req %w", err)
 	}
-	return string(b)
+	return string(b), nil
 }
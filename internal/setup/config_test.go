@@ -0,0 +1,188 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rest-api/internal/auth"
+	"github.com/rest-api/internal/logger"
+)
+
+// serveTest calls the handler with a request log in the context
+func serveTest(h Handler, format string) (*httptest.ResponseRecorder, *logger.Log) {
+	req := &logger.Log{ID: "req-1"}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), logger.RequestKey, req))
+	w := httptest.NewRecorder()
+	h.serve(w, r, format)
+	return w, req
+}
+
+func TestServeErrors(t *testing.T) {
+	notFound := &logger.APIErr{RespBody: logger.RespBody{Msg: "kittn id was not found: 7", Code: http.StatusNotFound}}
+
+	cases := map[string]struct {
+		h       Handler
+		format  string
+		code    int
+		body    string
+		ctype   string
+		errText string
+	}{
+		"api error": {
+			h:     func(http.ResponseWriter, *http.Request) error { return notFound },
+			code:  http.StatusNotFound,
+			body:  `"message":"kittn id was not found: 7"`,
+			ctype: ContentJSON,
+		},
+		"wrapped api error": {
+			h: func(http.ResponseWriter, *http.Request) error {
+				return errors.Join(errors.New("lookup"), notFound)
+			},
+			code:    http.StatusNotFound,
+			body:    `"code":404`,
+			ctype:   ContentJSON,
+			errText: "lookup",
+		},
+		"problem": {
+			h:      func(http.ResponseWriter, *http.Request) error { return notFound },
+			format: ErrorProblem,
+			code:   http.StatusNotFound,
+			body:   `"instance":"urn:request:req-1"`,
+			ctype:  logger.ContentProblem,
+		},
+		"plain error": {
+			h:       func(http.ResponseWriter, *http.Request) error { return errors.New("db is down") },
+			code:    http.StatusInternalServerError,
+			body:    "please see request id: req-1",
+			ctype:   ContentJSON,
+			errText: "db is down",
+		},
+		"panic": {
+			h:       func(http.ResponseWriter, *http.Request) error { panic("boom") },
+			code:    http.StatusInternalServerError,
+			body:    "please see request id: req-1",
+			ctype:   ContentJSON,
+			errText: "panic: boom",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			w, req := serveTest(c.h, c.format)
+			if w.Code != c.code {
+				t.Errorf("expected %d, got %d", c.code, w.Code)
+			}
+			if !strings.Contains(w.Body.String(), c.body) {
+				t.Errorf("expected the body to have %s, got %s", c.body, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != c.ctype {
+				t.Errorf("expected content type %s, got %s", c.ctype, ct)
+			}
+			if req.APIError == nil || !strings.Contains(req.APIError.ErrText, c.errText) {
+				t.Errorf("expected the request log error to have %q, got %+v", c.errText, req.APIError)
+			}
+		})
+	}
+
+	// the shared APIErr isn't changed by the requests
+	if notFound.Status != "" || notFound.ErrText != "" {
+		t.Errorf("the shared error was changed %+v", notFound)
+	}
+}
+
+func TestServeAfterWrite(t *testing.T) {
+	cases := map[string]Handler{
+		"panic": func(w http.ResponseWriter, _ *http.Request) error {
+			w.WriteHeader(http.StatusAccepted)
+			io.WriteString(w, `{"id":1`)
+			panic("boom")
+		},
+		"error": func(w http.ResponseWriter, _ *http.Request) error {
+			io.WriteString(w, `{"id":1`)
+			return errors.New("encode failed")
+		},
+	}
+
+	for name, h := range cases {
+		t.Run(name, func(t *testing.T) {
+			w, req := serveTest(h, "")
+			if w.Body.String() != `{"id":1` {
+				t.Errorf("expected only the handler's body, got %s", w.Body)
+			}
+			if w.Code == http.StatusInternalServerError {
+				t.Error("the error status was written after the response started")
+			}
+			if req.APIError == nil {
+				t.Error("expected the error on the request log")
+			}
+		})
+	}
+}
+
+func TestServeAbort(t *testing.T) {
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("expected ErrAbortHandler to be re-panicked, got %v", p)
+		}
+	}()
+	serveTest(func(http.ResponseWriter, *http.Request) error { panic(http.ErrAbortHandler) }, "")
+}
+
+func TestPanicStack(t *testing.T) {
+	_, req := serveTest(func(http.ResponseWriter, *http.Request) error { panic("boom") }, "")
+	if req.APIError.Stack != "" {
+		t.Errorf("expected no stack when stack capture is off, got %s", req.APIError.Stack)
+	}
+}
+
+func TestValidateAuth(t *testing.T) {
+	apiConfig = &Config{Routes: Endpoints{"add": {
+		Path: "/", FullPath: "/v1/kittns", Methods: Methods{POST}, Auth: auth.Methods{auth.APIKey, auth.Basic},
+	}}}
+	defer func() { apiConfig = nil }()
+	defer auth.Init(nil)
+
+	auth.Init(nil)
+	if err := validate(); err == nil || !strings.Contains(err.Error(), "auth_options") {
+		t.Errorf("expected the unconfigured auth methods to fail at startup, got %v", err)
+	}
+
+	auth.Init(&auth.Options{APIKeys: []auth.APIKeyUser{{Key: "k1", Subject: "reporting"}}})
+	if err := validate(); err != nil {
+		t.Errorf("expected one configured method to be enough, got %v", err)
+	}
+}
+
+func TestSetupErrors(t *testing.T) {
+	defer func() { apiConfig = nil }()
+
+	if err := InitConfig(nil); err == nil {
+		t.Error("expected a nil config error")
+	}
+	if err := AddEndpoints(Endpoint{Path: "/"}); err == nil {
+		t.Error("expected an error adding endpoints before the config")
+	}
+	if err := AddRoutes(); err == nil {
+		t.Error("expected an error adding routes before the config")
+	}
+
+	if err := InitConfig(&Config{Routes: make(Endpoints)}); err != nil {
+		t.Fatal(err)
+	}
+	e := Endpoint{Version: "v1", Group: "kittns", Path: "/", Methods: Methods{GET}}
+	if err := AddEndpoints(e); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddEndpoints(e); err == nil || !strings.Contains(err.Error(), "duplicate endpoint (/v1/kittns)") {
+		t.Errorf("expected a duplicate endpoint error, got %v", err)
+	}
+	if _, err := (Endpoint{ResponseBody: make(chan int)}).MarshalResp(); err == nil {
+		t.Error("expected a marshal error")
+	}
+}
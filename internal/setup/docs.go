@@ -2,24 +2,32 @@ package setup
 
 import (
 	_ "embed"
+	stdjson "encoding/json"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 
-	"github.com/hydronica/go-openapi"
+	"github.com/rest-api/internal/auth"
+	"github.com/rest-api/internal/logger"
+	"github.com/rest-api/internal/openapi"
+	"github.com/rest-api/internal/tracing"
+	swaggerFiles "github.com/swaggo/files/v2"
+	"gopkg.in/yaml.v2"
 )
 
-type OpenAPI struct {
-	*openapi.OpenAPI
-}
-
 var docsSkipPaths = Skip{
 	{Contains: "docs"},
 	{Path: "/stats"},
 	{Path: "/status"},
+	{Path: "/healthz"},
+	{Path: "/readyz"},
 	{Contains: "version"},
 	{Path: "/"},
 }
@@ -47,97 +55,394 @@ func (sk Skip) Skipper(path string) bool {
 	return false
 }
 
+// the spec is built at startup and served from memory
+var specJSON, specYAML []byte
+
+// swaggerInit configures the embedded swagger ui to load the api spec
+const swaggerInit = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/docs/openapi.json",
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    filter: true,
+    docExpansion: "none",
+    defaultModelsExpandDepth: 10,
+    defaultModelExpandDepth: 10,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// WriteDocs writes the openapi json spec to a file
+func WriteDocs(path string) error {
+	if specJSON == nil {
+		return fmt.Errorf("the api docs have not been built")
+	}
+	return os.WriteFile(path, specJSON, 0644)
+}
+
+// securityScheme returns the openapi security scheme for the auth method
+func securityScheme(m auth.Method) *openapi.SecurityScheme {
+	switch m {
+	case auth.APIKey:
+		return &openapi.SecurityScheme{Type: "apiKey", In: "header", Name: auth.APIKeyHeader()}
+	case auth.Basic:
+		return &openapi.SecurityScheme{Type: "http", Scheme: "basic"}
+	case auth.JWT:
+		return &openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"}
+	}
+	return &openapi.SecurityScheme{Type: "apiKey", In: "header", Name: string(m), Description: "custom auth method"}
+}
+
+// BuildDocs generates the openapi spec from the endpoints, request and response
+// body schemas are derived from the go types of RequestBody and ResponseBody
 func BuildDocs() error {
-	o, err := openapi.NewFromJson(base)
-	if err != nil {
-		return err
+	oa := openapi.OpenAPI{}
+	if err := json.Unmarshal([]byte(base), &oa); err != nil {
+		return fmt.Errorf("could not parse base.json %w", err)
+	}
+	if oa.Paths == nil {
+		oa.Paths = make(map[string]openapi.PathItem)
+	}
+
+	sc := openapi.NewSchemas()
+	tags := make(map[string]bool)
+	for _, t := range oa.Tags {
+		tags[t.Name] = true
 	}
-	oa := OpenAPI{o}
+	newTags := make([]string, 0)
+	schemes := make(map[string]*openapi.SecurityScheme)
 
 	for _, ep := range EndpointsList() {
-		if docsSkipPaths.Skipper(ep.Path) {
+		if docsSkipPaths.Skipper(ep.FullPath) {
 			continue
 		}
+
+		tag := ep.Group
+		if tag == "" {
+			tag = "general"
+		}
+		if !tags[tag] {
+			tags[tag] = true
+			newTags = append(newTags, tag)
+		}
+
 		for _, m := range ep.Methods {
-			if ep.Group != "" {
-				oa.AddTag(ep.Group, "")
+			method := strings.ToLower(m.String())
+			op := &openapi.Operation{
+				Tags:        []string{tag},
+				Summary:     ep.Name,
+				Description: ep.Description,
+				OperationID: operationID(method, ep.FullPath),
+				Responses:   make(map[string]*openapi.Response),
 			}
 
-			ur, err := oa.AddRoute(ep.FullPath, strings.ToLower(m.String()), ep.Group, ep.Description, "")
-			if err != nil {
-				return fmt.Errorf("error adding route to docs %w", err)
+			for _, p := range ep.PathParams {
+				op.Parameters = append(op.Parameters, openapi.Parameter{
+					Name:        p.Name,
+					In:          "path",
+					Description: p.Description,
+					Required:    true, // path params are always required
+					Schema:      paramSchema(p),
+				})
 			}
 			for _, p := range ep.QueryParams {
-				oa.AddParam(ur, openapi.RouteParam{
-					Name:     p.Name,
-					Desc:     p.Description,
-					Location: "query",
-					Type:     openapi.String,
-					Required: p.Required,
+				op.Parameters = append(op.Parameters, openapi.Parameter{
+					Name:        p.Name,
+					In:          "query",
+					Description: p.Description,
+					Required:    p.Required,
+					Schema:      paramSchema(p),
 				})
 			}
-			for _, p := range ep.PathParams {
-				oa.AddParam(ur, openapi.RouteParam{
-					Name:     p.Name,
-					Desc:     p.Description,
-					Location: "path",
-					Type:     openapi.String,
-					Required: p.Required,
-				})
+
+			if ep.RequestBody != nil {
+				op.RequestBody = &openapi.RequestBody{
+					Description: fieldsDesc(ep.JSONFields),
+					Required:    true,
+					Content:     mediaTypes(sc, ep.consumes(), ep.RequestBody),
+				}
 			}
+
+			code := ep.SuccessCode
+			if code == 0 {
+				code = http.StatusOK
+			}
+			resp := &openapi.Response{Description: http.StatusText(code)}
 			if ep.ResponseBody != nil {
-				oa.AddRequest(ur, openapi.NewReqBody(openapi.Json, ep.Description, []openapi.ExampleObject{
-					{Name: ep.Name, Example: ep.ResponseBody, Desc: ep.Description},
-				}))
+				resp.Content = mediaTypes(sc, ep.produces(ep.ResponseBody), ep.ResponseBody)
 			}
+			op.Responses[strconv.Itoa(code)] = resp
+
+			format := errorFormat(ep.ErrorFormat)
+			op.Responses["default"] = errorResponse(sc, 0, format)
+			if len(ep.PathParams)+len(ep.QueryParams) > 0 || ep.RequestBody != nil {
+				op.Responses[strconv.Itoa(http.StatusBadRequest)] = errorResponse(sc, http.StatusBadRequest, format)
+			}
+			if ep.RequestBody != nil {
+				op.Responses[strconv.Itoa(http.StatusUnsupportedMediaType)] = errorResponse(sc, http.StatusUnsupportedMediaType, format)
+				op.Responses[strconv.Itoa(http.StatusUnprocessableEntity)] = errorResponse(sc, http.StatusUnprocessableEntity, format)
+			}
+
+			for _, a := range ep.Auth {
+				schemes[string(a)] = securityScheme(a)
+				op.Security = append(op.Security, map[string][]string{string(a): {}})
+			}
+			if len(ep.Auth) > 0 {
+				op.Responses[strconv.Itoa(http.StatusUnauthorized)] = errorResponse(sc, http.StatusUnauthorized, format)
+			}
+			if p, _ := ep.rateLimit(); p.Enabled() {
+				op.Responses[strconv.Itoa(http.StatusTooManyRequests)] = errorResponse(sc, http.StatusTooManyRequests, format)
+			}
+			if len(ep.Scopes) > 0 {
+				op.Scopes = ep.Scopes
+				op.Description = strings.TrimSpace(op.Description + "\n\nRequires scopes: " + strings.Join(ep.Scopes, ", "))
+				op.Responses[strconv.Itoa(http.StatusForbidden)] = errorResponse(sc, http.StatusForbidden, format)
+			}
+			catalogResponses(op, sc, ep.Errors, format)
+
+			if oa.Paths[ep.FullPath] == nil {
+				oa.Paths[ep.FullPath] = make(openapi.PathItem)
+			}
+			oa.Paths[ep.FullPath][method] = op
 		}
+	}
 
+	sort.Strings(newTags)
+	for _, t := range newTags {
+		oa.Tags = append(oa.Tags, openapi.Tag{Name: t})
+	}
+	oa.Components.Schemas = sc.Components()
+	if len(schemes) > 0 {
+		oa.Components.SecuritySchemes = schemes
 	}
 
-	os.WriteFile("./swagger.json", oa.JSON(), os.ModePerm)
+	b, err := stdjson.MarshalIndent(oa, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal openapi spec %w", err)
+	}
 
+	// json is valid yaml, decoding into a MapSlice keeps the key order
+	var ms yaml.MapSlice
+	if err := yaml.Unmarshal(b, &ms); err != nil {
+		return fmt.Errorf("could not convert openapi spec to yaml %w", err)
+	}
+	y, err := yaml.Marshal(ms)
+	if err != nil {
+		return fmt.Errorf("could not marshal openapi spec yaml %w", err)
+	}
+
+	specJSON, specYAML = b, y
 	return nil
 }
 
+// paramSchema describes the param's type, default and constraints
+func paramSchema(p Param) *openapi.Schema {
+	sc := &openapi.Schema{Type: "string"}
+	switch p.Type {
+	case Int:
+		sc = &openapi.Schema{Type: "integer", Format: "int64"}
+	case Bool:
+		sc = &openapi.Schema{Type: "boolean"}
+	case Float:
+		sc = &openapi.Schema{Type: "number", Format: "double"}
+	case UUID:
+		sc.Format = "uuid"
+	case Time:
+		sc.Format = "date-time"
+	case Enum:
+		for _, v := range p.Enum {
+			sc.Enum = append(sc.Enum, v)
+		}
+	}
+
+	if p.Default != "" {
+		if v, err := p.parse(p.Default); err == nil {
+			sc.Default = v
+		}
+	}
+	if p.Validate != "" {
+		openapi.ApplyRules(sc, p.Validate)
+	}
+
+	return sc
+}
+
+// errorResponse describes an error response in the error format,
+// a code of 0 is used for the default response
+func errorResponse(sc *openapi.Schemas, code int, format string) *openapi.Response {
+	var body any = logger.RespBody{}
+	ct := ContentJSON
+	if format == ErrorProblem {
+		body, ct = logger.Problem{}, logger.ContentProblem
+	}
+
+	desc := "Error"
+	if code > 0 {
+		desc = http.StatusText(code)
+	}
+	return &openapi.Response{
+		Description: desc,
+		Content:     map[string]openapi.MediaType{ct: {Schema: sc.Of(body)}},
+	}
+}
+
+// catalogResponses documents the endpoint's error responses with an example for each error key,
+// errors with the same code are examples of a single response
+func catalogResponses(op *openapi.Operation, sc *openapi.Schemas, errs []ErrorResp, format string) {
+	for _, er := range errs {
+		code := strconv.Itoa(er.Code)
+		resp, found := op.Responses[code]
+		if !found {
+			resp = errorResponse(sc, er.Code, format)
+			op.Responses[code] = resp
+		}
+
+		a := &logger.APIErr{RespBody: logger.RespBody{Msg: er.Msg, Code: er.Code, Status: http.StatusText(er.Code), Key: er.Key}}
+		var value any = a.RespBody
+		if format == ErrorProblem {
+			value = a.Problem("")
+		}
+		summary := er.Description
+		if summary == "" {
+			summary = er.Msg
+		}
+
+		for ct, mt := range resp.Content {
+			if mt.Examples == nil {
+				mt.Examples = make(map[string]openapi.Example)
+			}
+			mt.Examples[er.Key] = openapi.Example{Summary: summary, Value: value}
+			resp.Content[ct] = mt
+		}
+
+		if op.Errors == nil {
+			op.Errors = make(map[string]int)
+		}
+		op.Errors[er.Key] = er.Code
+	}
+}
+
+// mediaTypes describes the body for each media type, the example is shown for the first (default) type
+func mediaTypes(sc *openapi.Schemas, types []string, body any) map[string]openapi.MediaType {
+	content := make(map[string]openapi.MediaType, len(types))
+	for i, t := range types {
+		mt := openapi.MediaType{Schema: sc.Of(body)}
+		if i == 0 {
+			mt.Example = body
+		}
+		content[t] = mt
+	}
+	return content
+}
+
+// contentType defaults an empty content type to json
+func contentType(ct string) string {
+	if ct == "" {
+		return ContentJSON
+	}
+	return ct
+}
+
+// operationID builds a unique id from the method and path i.e., get_v1_kittns_id
+func operationID(method, path string) string {
+	id := method
+	for _, p := range strings.FieldsFunc(path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		id += "_" + p
+	}
+	return id
+}
+
+// fieldsDesc lists the JSONFields as the request body description
+func fieldsDesc(fields []Param) string {
+	lines := make([]string, 0, len(fields))
+	for _, f := range fields {
+		l := "- `" + f.Name + "`"
+		if f.Required {
+			l += " (required)"
+		}
+		if f.Description != "" {
+			l += " " + f.Description
+		}
+		lines = append(lines, l)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Docs serves the openapi spec and the swagger ui,
+// the ui is proxied to the SwaggerUI origin when it is configured
+// otherwise the ui embedded in the binary is used
 func Docs(w http.ResponseWriter, r *http.Request) {
-	urlStr := r.URL.String()
-	if strings.Contains(urlStr, "/swagger.json") {
-		b, _ := os.ReadFile("swagger.json")
+	// do not log api docs requests
+	req, ok := r.Context().Value(logger.RequestKey).(*logger.Log)
+	if ok {
+		req.NoLog = true
+	}
+
+	file := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/docs"), "/")
+	switch file {
+	case "openapi.json":
 		w.Header().Set("Content-Type", ContentJSON)
 		w.WriteHeader(http.StatusOK)
+		w.Write(specJSON)
+		return
+	case "openapi.yaml":
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(specYAML)
+		return
+	}
+
+	if apiConfig.SwaggerUI != "" {
+		proxyURL, err := url.Parse(apiConfig.SwaggerUI)
+		if err != nil {
+			logger.Ctx(r.Context()).Error("invalid swagger_ui origin", "swagger_ui", apiConfig.SwaggerUI, "error", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		proxy := httputil.ReverseProxy{Director: func(rNew *http.Request) {
+			rNew.URL.Scheme = proxyURL.Scheme
+			rNew.URL.Host = proxyURL.Host
+			rNew.URL.Path = proxyURL.Path + r.URL.Path
+			rNew.Host = proxyURL.Host
+		}, Transport: tracing.Transport(nil)}
+		proxy.ServeHTTP(w, r)
+		return
+	}
+
+	switch file {
+	case "", "index.html":
+		// the ui uses relative paths so it must be served under /docs/
+		if r.URL.Path != "/docs/index.html" {
+			http.Redirect(w, r, "/docs/index.html", http.StatusMovedPermanently)
+			return
+		}
+		// the file server would redirect index.html back to the directory
+		b, err := fs.ReadFile(swaggerFiles.FS, "index.html")
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
 		w.Write(b)
 		return
+	case "swagger-initializer.js":
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(swaggerInit))
+		return
 	}
 
-	proxyURL, _ := url.Parse("http://swagger_ui:8080")
-	proxyURL, _ = url.Parse("http://localhost:8080")
-
-	proxy := httputil.ReverseProxy{Director: func(rNew *http.Request) {
-		rNew.URL.Scheme = proxyURL.Scheme
-		rNew.URL.Host = proxyURL.Host
-		rNew.URL.Path = proxyURL.Path + r.URL.Path
-		rNew.Host = proxyURL.Host
-	}}
-
-	proxy.ServeHTTP(w, r)
-
-	// // redirect if full path is not given
-	// if !strings.Contains(urlStr, "/docs/") {
-	// 	http.Redirect(w, r, "/docs/#introduction", http.StatusMovedPermanently)
-	// 	return
-	// }
-
-	// // do not log api docs requests
-	// req, ok := r.Context().Value(logger.RequestKey).(*logger.Log)
-	// if ok {
-	// 	req.NoLog = true
-	// }
-
-	// workDir, _ := os.Getwd()
-	// root := http.Dir(filepath.Join(workDir, "docs/build"))
-	// rctx := chi.RouteContext(r.Context())
-	// rp := rctx.RoutePattern()
-	// prefix := strings.TrimSuffix(rp, "/*")
-	// fs := http.StripPrefix(prefix, http.FileServer(root))
-	// fs.ServeHTTP(w, r)
+	http.StripPrefix("/docs/", http.FileServer(http.FS(swaggerFiles.FS))).ServeHTTP(w, r)
 }
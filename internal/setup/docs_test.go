@@ -0,0 +1,110 @@
+package setup
+
+import (
+	stdjson "encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rest-api/internal/auth"
+	"github.com/rest-api/internal/logger"
+	"github.com/rest-api/internal/openapi"
+)
+
+type docKitten struct {
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name" validate:"required,maxlen=50"`
+}
+
+func TestBuildDocs(t *testing.T) {
+	apiConfig = &Config{Routes: Endpoints{
+		"get": {
+			Name: "Get Kittn", Group: "kittns", FullPath: "/v1/kittns/{id}", Methods: Methods{GET},
+			PathParams:   []Param{{Name: "id", Type: Int, Validate: "min=1"}},
+			QueryParams:  []Param{{Name: "fields", Type: Enum, Enum: []string{"all", "name"}, Default: "all"}},
+			ResponseBody: docKitten{ID: 1, Name: "Tom"},
+			Auth:         auth.Methods{auth.JWT},
+			Scopes:       []string{"kittns:read"},
+			Errors:       []ErrorResp{{Key: "not_found", Code: http.StatusNotFound, Msg: "kittn %d was not found"}},
+		},
+		"post": {
+			Name: "Add Kittn", Group: "kittns", FullPath: "/v1/kittns", Methods: Methods{POST},
+			RequestBody: docKitten{Name: "Tom"}, ResponseBody: docKitten{ID: 1, Name: "Tom"},
+			Consumes: []string{ContentJSON, ContentYAML}, SuccessCode: http.StatusCreated, ErrorFormat: ErrorProblem,
+			JSONFields: []Param{{Name: "name", Required: true}},
+		},
+		"skipped": {Name: "Docs", FullPath: "/docs/openapi.json", Methods: Methods{GET}},
+	}}
+	defer func() { apiConfig = nil }()
+
+	if err := BuildDocs(); err != nil {
+		t.Fatal(err)
+	}
+	oa := openapi.OpenAPI{}
+	if err := stdjson.Unmarshal(specJSON, &oa); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(specYAML), "openapi: ") {
+		t.Errorf("expected the yaml spec, got %.100s", specYAML)
+	}
+
+	if _, found := oa.Paths["/docs/openapi.json"]; found {
+		t.Error("the docs routes should be skipped")
+	}
+
+	get := oa.Paths["/v1/kittns/{id}"]["get"]
+	if get == nil || get.OperationID != "get_v1_kittns_id" || get.Tags[0] != "kittns" {
+		t.Fatalf("expected the get operation, got %+v", get)
+	}
+	id, fields := get.Parameters[0], get.Parameters[1]
+	if id.In != "path" || !id.Required || id.Schema.Type != "integer" || *id.Schema.Minimum != 1 {
+		t.Errorf("unexpected path param %+v %+v", id, id.Schema)
+	}
+	if fields.In != "query" || fields.Schema.Default != "all" || len(fields.Schema.Enum) != 2 {
+		t.Errorf("unexpected query param %+v %+v", fields, fields.Schema)
+	}
+	for _, code := range []string{"200", "400", "401", "403", "404", "default"} {
+		if get.Responses[code] == nil {
+			t.Errorf("get expected a %s response", code)
+		}
+	}
+	if ex := get.Responses["404"].Content[ContentJSON].Examples["not_found"]; ex.Summary != "kittn %d was not found" {
+		t.Errorf("expected the error catalog example, got %+v", ex)
+	}
+	if get.Errors["not_found"] != http.StatusNotFound || get.Scopes[0] != "kittns:read" || len(get.Security) != 1 {
+		t.Errorf("expected the errors, scopes and security, got %+v", get)
+	}
+	if oa.Components.SecuritySchemes[string(auth.JWT)] == nil {
+		t.Errorf("expected the jwt security scheme, got %v", oa.Components.SecuritySchemes)
+	}
+
+	post := oa.Paths["/v1/kittns"]["post"]
+	if post == nil || post.RequestBody == nil {
+		t.Fatalf("expected the post operation, got %+v", post)
+	}
+	if len(post.RequestBody.Content) != 2 || post.RequestBody.Content[ContentYAML].Schema.Ref != "#/components/schemas/docKitten" {
+		t.Errorf("expected the json and yaml request bodies, got %+v", post.RequestBody.Content)
+	}
+	if post.RequestBody.Description != "- `name` (required)" {
+		t.Errorf("expected the fields description, got %q", post.RequestBody.Description)
+	}
+	for _, code := range []string{"201", "400", "415", "422"} {
+		if post.Responses[code] == nil {
+			t.Errorf("post expected a %s response", code)
+		}
+	}
+	if _, found := post.Responses["422"].Content[logger.ContentProblem]; !found {
+		t.Errorf("expected problem errors, got %v", post.Responses["422"].Content)
+	}
+
+	k := oa.Components.Schemas["docKitten"]
+	if k == nil || len(k.Required) != 1 || k.Required[0] != "name" || *k.Properties["name"].MaxLength != 50 {
+		t.Errorf("unexpected kitten schema %+v", k)
+	}
+}
+
+func TestOperationID(t *testing.T) {
+	if id := operationID("get", "/v1/kittns/{id}/toys"); id != "get_v1_kittns_id_toys" {
+		t.Errorf("unexpected id %s", id)
+	}
+}
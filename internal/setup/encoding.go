@@ -0,0 +1,609 @@
+package setup
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rest-api/internal/openapi"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+// media types with a registered encoder
+const (
+	ContentXML      = "application/xml"
+	ContentYAML     = "application/yaml"
+	ContentMsgPack  = "application/msgpack"
+	ContentCSV      = "text/csv"
+	ContentProtobuf = "application/x-protobuf"
+)
+
+// Encoder writes response bodies for a media type,
+// encoders that implement Decoder also read request bodies
+type Encoder interface {
+	// Supports returns true when the value can be encoded i.e., csv needs a slice of structs
+	Supports(v any) bool
+	Encode(w io.Writer, v any, pretty bool) error
+}
+
+// Decoder reads a request body into v
+type Decoder interface {
+	Decode(body []byte, v any) error
+}
+
+// FieldDecoder is a Decoder that can't decode into a map i.e., xml, Fields returns
+// the fields in the body by their json names for the JSONFields checks of v's type
+type FieldDecoder interface {
+	Fields(body []byte, v any) (map[string]any, error)
+}
+
+// encoders are the registered encoders by media type, order is the registration order
+var (
+	encoders = make(map[string]Encoder)
+	order    []string
+)
+
+func init() {
+	RegisterEncoder(ContentJSON, jsonEncoder{})
+	RegisterEncoder(ContentXML, xmlEncoder{})
+	RegisterEncoder(ContentYAML, yamlEncoder{})
+	RegisterEncoder(ContentMsgPack, msgpackEncoder{})
+	RegisterEncoder(ContentCSV, csvEncoder{})
+	RegisterEncoder(ContentProtobuf, protoEncoder{})
+}
+
+// RegisterEncoder adds or replaces the encoder for the media type,
+// it must be called before the routes are added
+func RegisterEncoder(mediaType string, e Encoder) {
+	if _, found := encoders[mediaType]; !found {
+		order = append(order, mediaType)
+	}
+	encoders[mediaType] = e
+}
+
+// produces returns the media types the endpoint can write v as, the ResponseType is first.
+// All registered types are used when the endpoint doesn't list its Produces types
+func (e Endpoint) produces(v any) []string {
+	types := e.Produces
+	if len(types) == 0 {
+		types = order
+	}
+
+	def := contentType(e.ResponseType)
+	list := []string{def}
+	for _, t := range types {
+		if t != def {
+			list = append(list, t)
+		}
+	}
+
+	supported := make([]string, 0, len(list))
+	for _, t := range list {
+		if enc, found := encoders[t]; found && enc.Supports(v) {
+			supported = append(supported, t)
+		}
+	}
+	return supported
+}
+
+// consumes returns the media types the endpoint can read, the RequestType is first.
+// All registered decoders are used when the endpoint doesn't list its Consumes types
+func (e Endpoint) consumes() []string {
+	types := e.Consumes
+	if len(types) == 0 {
+		types = order
+	}
+
+	def := contentType(e.RequestType)
+	list := []string{def}
+	for _, t := range types {
+		if t != def {
+			list = append(list, t)
+		}
+	}
+
+	decodable := make([]string, 0, len(list))
+	for _, t := range list {
+		if _, ok := encoders[t].(Decoder); ok {
+			decodable = append(decodable, t)
+		}
+	}
+	return decodable
+}
+
+// validateMediaTypes checks the endpoint's media types have a registered encoder
+func validateMediaTypes(e Endpoint) error {
+	for _, t := range append(append([]string{e.ResponseType, e.RequestType}, e.Produces...), e.Consumes...) {
+		if t == "" {
+			continue
+		}
+		if _, found := encoders[t]; !found {
+			return fmt.Errorf("no encoder registered for %s %v (%s)", t, e.Methods, e.FullPath)
+		}
+	}
+	for _, t := range e.Consumes {
+		if _, ok := encoders[t].(Decoder); !ok {
+			return fmt.Errorf("the %s encoder can't decode request bodies %v (%s)", t, e.Methods, e.FullPath)
+		}
+	}
+	return nil
+}
+
+// accepted is a media range from the Accept header
+type accepted struct {
+	typ, sub string
+	q        float64
+}
+
+// negotiate picks the offer with the highest quality in the Accept header,
+// ties go to the first offer. The first offer is used when there isn't an Accept header
+func negotiate(accept string, offers []string) (string, bool) {
+	if len(offers) == 0 {
+		return "", false
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	var ranges []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, found := params["q"]; found {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		typ, sub, _ := strings.Cut(mt, "/")
+		ranges = append(ranges, accepted{typ: typ, sub: sub, q: q})
+	}
+	// the most specific range that matches an offer sets its quality
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return specificity(ranges[i]) > specificity(ranges[j])
+	})
+
+	best, bestQ := "", 0.0
+	for _, o := range offers {
+		typ, sub, _ := strings.Cut(o, "/")
+		for _, r := range ranges {
+			if (r.typ == "*" || r.typ == typ) && (r.sub == "*" || r.sub == sub) {
+				if r.q > bestQ {
+					best, bestQ = o, r.q
+				}
+				break
+			}
+		}
+	}
+	return best, best != ""
+}
+
+func specificity(a accepted) int {
+	switch {
+	case a.typ == "*":
+		return 0
+	case a.sub == "*":
+		return 1
+	}
+	return 2
+}
+
+// jsonEncoder is the default encoder
+type jsonEncoder struct{}
+
+func (jsonEncoder) Supports(any) bool { return true }
+
+func (jsonEncoder) Encode(w io.Writer, v any, pretty bool) error {
+	var b []byte
+	var err error
+	if pretty {
+		b, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		b, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (jsonEncoder) Decode(body []byte, v any) error {
+	return json.Unmarshal(body, v)
+}
+
+// xmlEncoder uses the go field names or xml tags, slices are written as item elements in an items root
+type xmlEncoder struct{}
+
+type xmlItems struct {
+	XMLName xml.Name `xml:"items"`
+	Items   any      `xml:"item"`
+}
+
+// Supports returns false for types with maps, they can't be written as xml
+func (xmlEncoder) Supports(v any) bool {
+	return v != nil && xmlType(reflect.TypeOf(v), make(map[reflect.Type]bool))
+}
+
+func xmlType(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return true
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Map, reflect.Func, reflect.Chan:
+		return false
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return xmlType(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.IsExported() && f.Tag.Get("xml") != "-" && !xmlType(f.Type, seen) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (xmlEncoder) Encode(w io.Writer, v any, pretty bool) error {
+	if k := reflect.TypeOf(v).Kind(); k == reflect.Slice || k == reflect.Array {
+		v = xmlItems{Items: v}
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if pretty {
+		enc.Indent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
+func (xmlEncoder) Decode(body []byte, v any) error {
+	return xml.Unmarshal(body, v)
+}
+
+// xmlNode is an element of a decoded xml body
+type xmlNode struct {
+	attrs    map[string]string
+	children map[string][]*xmlNode
+	text     string
+}
+
+// Fields decodes the body into an element tree and maps the elements and attributes
+// that were sent to the json names of v's fields, only fields in the body are returned
+func (xmlEncoder) Fields(body []byte, v any) (map[string]any, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{attrs: make(map[string]string), children: make(map[string][]*xmlNode)}
+			for _, a := range t.Attr {
+				n.attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children[t.Name.Local] = append(parent.children[t.Name.Local], n)
+			} else if root == nil {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return map[string]any{}, nil
+	}
+
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	fields, _ := xmlFields(root, t).(map[string]any)
+	if fields == nil {
+		fields = map[string]any{}
+	}
+	return fields, nil
+}
+
+// xmlFields is the node's value for the type, structs are maps of the fields that
+// were sent keyed by their json names and other values are the element's text
+func xmlFields(n *xmlNode, t reflect.Type) any {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || t == timeType {
+		return strings.TrimSpace(n.text)
+	}
+
+	fields := make(map[string]any)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() || sf.Name == "XMLName" {
+			continue
+		}
+		tag := sf.Tag.Get("xml")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" {
+			if embedded, ok := xmlFields(n, sf.Type).(map[string]any); ok {
+				for k, v := range embedded {
+					fields[k] = v
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		jsonName, _ := openapi.JSONName(sf)
+		if jsonName == "-" {
+			continue
+		}
+
+		if strings.Contains(opts, "attr") {
+			if v, found := n.attrs[name]; found {
+				fields[jsonName] = v
+			}
+			continue
+		}
+
+		// a>b tags are nested elements, repeated elements are the items of a slice
+		parent := n
+		path := strings.Split(name, ">")
+		for _, p := range path[:len(path)-1] {
+			if parent = xmlChild(parent, p); parent == nil {
+				break
+			}
+		}
+		if parent == nil || len(parent.children[path[len(path)-1]]) == 0 {
+			continue
+		}
+		nodes := parent.children[path[len(path)-1]]
+		node, ft := nodes[0], sf.Type
+		if ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8 {
+			items := make([]any, len(nodes))
+			for i, c := range nodes {
+				items[i] = xmlFields(c, ft.Elem())
+			}
+			fields[jsonName] = items
+			continue
+		}
+		fields[jsonName] = xmlFields(node, ft)
+	}
+	return fields
+}
+
+// xmlChild is the first child element with the name
+func xmlChild(n *xmlNode, name string) *xmlNode {
+	if c := n.children[name]; len(c) > 0 {
+		return c[0]
+	}
+	return nil
+}
+
+// yamlEncoder converts to and from json so the json tags are used for the field names
+type yamlEncoder struct{}
+
+func (yamlEncoder) Supports(any) bool { return true }
+
+func (yamlEncoder) Encode(w io.Writer, v any, _ bool) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// decoding into a MapSlice keeps the field order
+	var out any
+	switch {
+	case bytes.HasPrefix(b, []byte("{")):
+		ms := yaml.MapSlice{}
+		err = yaml.Unmarshal(b, &ms)
+		out = ms
+	case bytes.HasPrefix(b, []byte("[{")):
+		var list []yaml.MapSlice
+		err = yaml.Unmarshal(b, &list)
+		out = list
+	default:
+		err = yaml.Unmarshal(b, &out)
+	}
+	if err != nil {
+		return err
+	}
+	y, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(y)
+	return err
+}
+
+func (yamlEncoder) Decode(body []byte, v any) error {
+	var raw any
+	if err := yaml.Unmarshal(body, &raw); err != nil {
+		return err
+	}
+	b, err := json.Marshal(stringKeys(raw))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// stringKeys converts the map[any]any values from yaml into map[string]any
+func stringKeys(v any) any {
+	switch t := v.(type) {
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return m
+	case []any:
+		for i := range t {
+			t[i] = stringKeys(t[i])
+		}
+	}
+	return v
+}
+
+// msgpackEncoder uses the json tags for the field names
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) Supports(any) bool { return true }
+
+func (msgpackEncoder) Encode(w io.Writer, v any, _ bool) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+func (msgpackEncoder) Decode(body []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(body))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// Tabular is a response with a list of rows i.e., the Data of a listquery.Page,
+// the csv encoder writes the rows
+type Tabular interface {
+	Rows() any
+}
+
+// csvEncoder writes a slice of structs, or the rows of a Tabular response,
+// with a header row of the json field names, nested values are written as json
+type csvEncoder struct{}
+
+func (csvEncoder) Supports(v any) bool {
+	if tb, ok := v.(Tabular); ok {
+		v = tb.Rows()
+	}
+	t := reflect.TypeOf(v)
+	if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array) {
+		return false
+	}
+	t = t.Elem()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+func (csvEncoder) Encode(w io.Writer, v any, _ bool) error {
+	if tb, ok := v.(Tabular); ok {
+		v = tb.Rows()
+	}
+	rv := reflect.ValueOf(v)
+	t := rv.Type().Elem()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var header []string
+	var fields []int
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || f.Anonymous || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	row := make([]string, len(fields))
+	for i := 0; i < rv.Len(); i++ {
+		item := reflect.Indirect(rv.Index(i))
+		for j, f := range fields {
+			if !item.IsValid() {
+				row[j] = ""
+				continue
+			}
+			row[j] = csvValue(item.Field(f))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v.Interface())
+	}
+	b, _ := json.Marshal(v.Interface())
+	return string(b)
+}
+
+// protoEncoder is used for protobuf message types
+type protoEncoder struct{}
+
+func (protoEncoder) Supports(v any) bool {
+	_, ok := v.(proto.Message)
+	return ok
+}
+
+func (protoEncoder) Encode(w io.Writer, v any, _ bool) error {
+	b, err := proto.Marshal(v.(proto.Message))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Decode reads into a proto.Message, v may also point to a nil message pointer
+func (protoEncoder) Decode(body []byte, v any) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(body, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && rv.Elem().Kind() == reflect.Pointer {
+		if _, ok := rv.Elem().Interface().(proto.Message); ok {
+			rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+			return proto.Unmarshal(body, rv.Elem().Interface().(proto.Message))
+		}
+	}
+	return errors.New("the request type is not a protobuf message")
+}
@@ -0,0 +1,202 @@
+package setup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rest-api/internal/listquery"
+	"github.com/rest-api/internal/logger"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{ContentJSON, ContentXML, ContentCSV}
+	cases := map[string]struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		"no header":         {accept: "", want: ContentJSON, ok: true},
+		"exact":             {accept: "application/xml", want: ContentXML, ok: true},
+		"any":               {accept: "*/*", want: ContentJSON, ok: true},
+		"subtype wildcard":  {accept: "text/*", want: ContentCSV, ok: true},
+		"q values":          {accept: "application/json;q=0.5, text/csv;q=0.9", want: ContentCSV, ok: true},
+		"specific wins":     {accept: "application/*;q=0.2, application/xml;q=0.8, */*;q=0.1", want: ContentXML, ok: true},
+		"excluded":          {accept: "application/json;q=0, */*;q=0.5", want: ContentXML, ok: true},
+		"tie goes to first": {accept: "application/xml, application/json", want: ContentJSON, ok: true},
+		"browser":           {accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: ContentXML, ok: true},
+		"none acceptable":   {accept: "text/html", ok: false},
+		"invalid range":     {accept: "json", ok: false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			got, ok := negotiate(c.accept, offers)
+			if got != c.want || ok != c.ok {
+				t.Errorf("expected %q %v, got %q %v", c.want, c.ok, got, ok)
+			}
+		})
+	}
+	if _, ok := negotiate("*/*", nil); ok {
+		t.Error("expected no type without offers")
+	}
+}
+
+type row struct {
+	ID   int               `json:"id"`
+	Name string            `json:"name"`
+	Tags map[string]string `json:"tags,omitempty"`
+	Skip string            `json:"-"`
+}
+
+type xmlRow struct {
+	ID   int      `json:"id" xml:"id,attr"`
+	Name string   `json:"name"`
+	Toys []string `json:"toys" xml:"toys>toy"`
+}
+
+// writeTest writes v for the endpoint with the Accept header
+func writeTest(e Endpoint, accept string, v any) (*httptest.ResponseRecorder, error) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", accept)
+	r = r.WithContext(context.WithValue(r.Context(), endpointKey, e))
+	w := httptest.NewRecorder()
+	return w, Write(w, r, http.StatusOK, v)
+}
+
+func TestWrite(t *testing.T) {
+	e := Endpoint{ResponseType: ContentJSON}
+	rows := []row{{ID: 1, Name: "Tom", Tags: map[string]string{"a": "b"}}, {ID: 2, Name: "Max, Jr"}}
+
+	cases := map[string]struct {
+		accept string
+		v      any
+		ctype  string
+		body   string
+	}{
+		"json":      {accept: "", v: rows[0], ctype: ContentJSON, body: `{"id":1,"name":"Tom","tags":{"a":"b"}}`},
+		"xml":       {accept: ContentXML, v: xmlRow{ID: 1, Name: "Tom", Toys: []string{"ball"}}, ctype: ContentXML, body: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<xmlRow id="1"><Name>Tom</Name><toys><toy>ball</toy></toys></xmlRow>`},
+		"xml list":  {accept: ContentXML, v: []xmlRow{{ID: 1}}, ctype: ContentXML, body: `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<items><item id="1"><Name></Name><toys></toys></item></items>`},
+		"yaml":      {accept: ContentYAML, v: rows[0], ctype: ContentYAML, body: "id: 1\nname: Tom\ntags:\n  a: b\n"},
+		"csv":       {accept: ContentCSV, v: rows, ctype: ContentCSV, body: "id,name,tags\n1,Tom,\"{\"\"a\"\":\"\"b\"\"}\"\n2,\"Max, Jr\",null\n"},
+		"csv page":  {accept: ContentCSV, v: listquery.Page[row]{Data: rows[1:], Total: 2}, ctype: ContentCSV, body: "id,name,tags\n2,\"Max, Jr\",null\n"},
+		"json page": {accept: ContentJSON, v: listquery.Page[row]{Data: rows[1:], Total: 2}, ctype: ContentJSON, body: `{"data":[{"id":2,"name":"Max, Jr"}],"total":2,"limit":0,"offset":0}`},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			w, err := writeTest(e, c.accept, c.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != c.ctype {
+				t.Errorf("expected %s, got %s", c.ctype, ct)
+			}
+			if w.Header().Get("Vary") != "Accept" {
+				t.Errorf("expected Vary: Accept, got %q", w.Header().Get("Vary"))
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != strings.TrimSpace(c.body) {
+				t.Errorf("expected\n%s\ngot\n%s", c.body, got)
+			}
+		})
+	}
+
+	// msgpack uses the json names
+	w, err := writeTest(e, ContentMsgPack, rows[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]any{}
+	if err := msgpack.Unmarshal(w.Body.Bytes(), &m); err != nil || m["name"] != "Tom" {
+		t.Errorf("expected the msgpack json names, got %v %v", m, err)
+	}
+}
+
+func TestWriteNotAcceptable(t *testing.T) {
+	// csv can't write a single struct and the endpoint only produces json and csv
+	e := Endpoint{ResponseType: ContentJSON, Produces: []string{ContentJSON, ContentCSV}}
+	if _, err := writeTest(Endpoint{ResponseType: ContentJSON}, ContentXML, row{Tags: map[string]string{}}); err == nil {
+		t.Error("expected xml to not be produced for a struct with a map")
+	}
+
+	_, err := writeTest(e, "text/csv", row{ID: 1})
+
+	var apiErr *logger.APIErr
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotAcceptable {
+		t.Fatalf("expected a 406, got %v", err)
+	}
+	if apiErr.RespBody.Msg != "the response can be returned as "+ContentJSON {
+		t.Errorf("expected the offered types, got %q", apiErr.RespBody.Msg)
+	}
+
+	if _, err := writeTest(e, ContentXML, row{ID: 1}); err == nil {
+		t.Error("expected xml to not be produced")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	e := Endpoint{RequestType: ContentJSON, Consumes: []string{ContentJSON, ContentYAML, ContentMsgPack}}
+	packed, _ := msgpack.Marshal(map[string]any{"id": 3, "name": "Tom"})
+
+	cases := map[string]struct {
+		ctype string
+		body  []byte
+		code  int
+	}{
+		"json":            {ctype: "application/json; charset=utf-8", body: []byte(`{"id":3,"name":"Tom"}`)},
+		"default type":    {body: []byte(`{"id":3,"name":"Tom"}`)},
+		"yaml":            {ctype: ContentYAML, body: []byte("id: 3\nname: Tom\n")},
+		"msgpack":         {ctype: ContentMsgPack, body: packed},
+		"not consumed":    {ctype: ContentXML, body: []byte(`<row><ID>3</ID></row>`), code: http.StatusUnsupportedMediaType},
+		"unknown type":    {ctype: "text/plain", body: []byte(`3`), code: http.StatusUnsupportedMediaType},
+		"bad json":        {ctype: ContentJSON, body: []byte(`{"id":`), code: http.StatusBadRequest},
+		"bad yaml":        {ctype: ContentYAML, body: []byte("id: [3"), code: http.StatusBadRequest},
+		"wrong json type": {ctype: ContentJSON, body: []byte(`{"id":"three"}`), code: http.StatusBadRequest},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(c.body))
+			if c.ctype != "" {
+				r.Header.Set("Content-Type", c.ctype)
+			}
+			var v row
+			raw, err := decode(r, e, &v)
+			if c.code != 0 {
+				var apiErr *logger.APIErr
+				if !errors.As(err, &apiErr) || apiErr.Code != c.code {
+					t.Fatalf("expected a %d, got %v", c.code, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.ID != 3 || v.Name != "Tom" {
+				t.Errorf("unexpected value %+v", v)
+			}
+			if _, found := raw["name"]; !found || len(raw) != 2 {
+				t.Errorf("expected the sent fields, got %v", raw)
+			}
+		})
+	}
+}
+
+func TestMediaTypes(t *testing.T) {
+	e := Endpoint{ResponseType: ContentXML, Produces: []string{ContentJSON, ContentCSV}}
+	if got := e.produces(xmlRow{}); strings.Join(got, ",") != ContentXML+","+ContentJSON {
+		t.Errorf("expected the response type first without csv, got %v", got)
+	}
+	if got := (Endpoint{}).consumes(); got[0] != ContentJSON || len(got) != 5 {
+		t.Errorf("expected every decoder with json first, got %v", got)
+	}
+
+	if err := validateMediaTypes(Endpoint{Produces: []string{"text/html"}}); err == nil {
+		t.Error("expected an error for a type without an encoder")
+	}
+	if err := validateMediaTypes(Endpoint{Consumes: []string{ContentCSV}}); err == nil {
+		t.Error("expected an error for a type that can't be decoded")
+	}
+}
@@ -0,0 +1,59 @@
+package setup
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rest-api/internal/logger"
+)
+
+// ErrorResp is an error response an endpoint can return with Fail,
+// each one is documented as a response of the endpoint
+type ErrorResp struct {
+	Key         string // identifies the error for clients i.e., not_found, it's returned as the error field
+	Code        int    // the http status code for the error
+	Msg         string // the external message, a fmt template for the Fail args i.e., "kittn %d was not found"
+	Description string // (api docs) when the error is returned
+}
+
+// Fail returns the endpoint's error response for the key with the args applied to the message template,
+// an unknown key is returned as a 500 error
+func (e Endpoint) Fail(key string, args ...any) error {
+	for _, er := range e.Errors {
+		if er.Key != key {
+			continue
+		}
+		msg := er.Msg
+		if len(args) > 0 {
+			msg = fmt.Sprintf(er.Msg, args...)
+		}
+		return &logger.APIErr{
+			Internal: logger.Internal{Msg: key + ": " + msg, Stack: logger.Stack(1)},
+			RespBody: logger.RespBody{Msg: msg, Code: er.Code, Key: key},
+		}
+	}
+
+	return &logger.APIErr{
+		Internal: logger.Internal{Msg: fmt.Sprintf("unknown error key %q %v (%s)", key, e.Methods, e.FullPath), Stack: logger.Stack(1)},
+		RespBody: logger.RespBody{Msg: "internal server error", Code: http.StatusInternalServerError},
+	}
+}
+
+// validateErrors checks the error keys are unique and the codes are 4xx or 5xx
+func validateErrors(e Endpoint) error {
+	keys := make(map[string]bool)
+	for _, er := range e.Errors {
+		if er.Key == "" || strings.ContainsAny(er.Key, " \t") {
+			return fmt.Errorf("error key %q must be set without spaces %v (%s)", er.Key, e.Methods, e.FullPath)
+		}
+		if keys[er.Key] {
+			return fmt.Errorf("duplicate error key %q %v (%s)", er.Key, e.Methods, e.FullPath)
+		}
+		keys[er.Key] = true
+		if er.Code < 400 || er.Code > 599 {
+			return fmt.Errorf("error %s needs a 4xx or 5xx code %v (%s)", er.Key, e.Methods, e.FullPath)
+		}
+	}
+	return nil
+}
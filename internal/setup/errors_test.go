@@ -0,0 +1,129 @@
+package setup
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rest-api/internal/logger"
+	"github.com/rest-api/internal/openapi"
+)
+
+var catalogEndpoint = Endpoint{
+	FullPath: "/v1/kittns/{id}", Methods: Methods{PUT}, SuccessCode: http.StatusAccepted,
+	Errors: []ErrorResp{
+		{Key: "not_found", Code: http.StatusNotFound, Msg: "kittn %d was not found"},
+		{Key: "gone", Code: http.StatusNotFound, Msg: "kittn was removed", Description: "the kittn was adopted"},
+		{Key: "conflict", Code: http.StatusConflict, Msg: "kittn name is taken"},
+		{Key: "bad_name", Code: http.StatusBadRequest, Msg: "kittn name %q isn't allowed"},
+	},
+}
+
+func TestFail(t *testing.T) {
+	cases := map[string]struct {
+		key  string
+		args []any
+		code int
+		msg  string
+	}{
+		"args":        {key: "not_found", args: []any{7}, code: http.StatusNotFound, msg: "kittn 7 was not found"},
+		"no args":     {key: "conflict", code: http.StatusConflict, msg: "kittn name is taken"},
+		"unknown key": {key: "missing", code: http.StatusInternalServerError, msg: "internal server error"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			var a *logger.APIErr
+			if !errors.As(catalogEndpoint.Fail(c.key, c.args...), &a) {
+				t.Fatal("expected an APIErr")
+			}
+			if a.Code != c.code || a.RespBody.Msg != c.msg {
+				t.Errorf("expected %d %q, got %d %q", c.code, c.msg, a.Code, a.RespBody.Msg)
+			}
+			if c.code == http.StatusInternalServerError {
+				if a.Key != "" || !strings.Contains(a.Internal.Msg, `unknown error key "missing"`) {
+					t.Errorf("expected the unknown key in the internal message, got %+v", a)
+				}
+			} else if a.Key != c.key {
+				t.Errorf("expected key %s, got %s", c.key, a.Key)
+			}
+		})
+	}
+}
+
+func TestServeFail(t *testing.T) {
+	// the catalog status is written, not the endpoint's success code
+	w, req := serveTest(func(http.ResponseWriter, *http.Request) error {
+		return catalogEndpoint.Fail("conflict")
+	}, "")
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"error":"conflict"`) {
+		t.Errorf("expected the conflict response, got %d %s", w.Code, w.Body)
+	}
+	if req.APIError == nil || req.APIError.Msg != "conflict: kittn name is taken" {
+		t.Errorf("expected the key in the request log error, got %+v", req.APIError)
+	}
+
+	w, _ = serveTest(func(http.ResponseWriter, *http.Request) error {
+		return catalogEndpoint.Fail("missing")
+	}, ErrorProblem)
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "missing") {
+		t.Errorf("expected an internal error without the key, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestValidateErrors(t *testing.T) {
+	cases := map[string]struct {
+		errs []ErrorResp
+		err  string
+	}{
+		"valid":     {errs: catalogEndpoint.Errors},
+		"empty key": {errs: []ErrorResp{{Code: 400}}, err: `error key "" must be set`},
+		"spaces":    {errs: []ErrorResp{{Key: "not found", Code: 404}}, err: "without spaces"},
+		"duplicate": {errs: []ErrorResp{{Key: "a", Code: 404}, {Key: "a", Code: 409}}, err: `duplicate error key "a"`},
+		"2xx code":  {errs: []ErrorResp{{Key: "a", Code: 200}}, err: "needs a 4xx or 5xx code"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := validateErrors(Endpoint{FullPath: "/v1/kittns", Methods: Methods{GET}, Errors: c.errs})
+			if c.err == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("expected %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestCatalogResponses(t *testing.T) {
+	sc := openapi.NewSchemas()
+	op := &openapi.Operation{Responses: map[string]*openapi.Response{
+		"400": errorResponse(sc, http.StatusBadRequest, ErrorProblem),
+	}}
+	catalogResponses(op, sc, catalogEndpoint.Errors, ErrorProblem)
+
+	// errors with the same code are examples of one response
+	nf := op.Responses["404"].Content[logger.ContentProblem].Examples
+	if len(nf) != 2 || nf["not_found"].Summary != "kittn %d was not found" || nf["gone"].Summary != "the kittn was adopted" {
+		t.Errorf("expected the not_found and gone examples, got %+v", nf)
+	}
+	if p, ok := nf["gone"].Value.(logger.Problem); !ok || p.Status != http.StatusNotFound || p.Instance != "" {
+		t.Errorf("expected a problem example, got %#v", nf["gone"].Value)
+	}
+
+	// a catalog code that's already documented adds an example to the response
+	if ex := op.Responses["400"].Content[logger.ContentProblem].Examples; len(ex) != 1 || ex["bad_name"].Summary == "" {
+		t.Errorf("expected the bad_name example on the 400 response, got %+v", ex)
+	}
+	if op.Responses["409"] == nil || op.Responses["409"].Description != "Conflict" {
+		t.Errorf("expected the conflict response, got %+v", op.Responses["409"])
+	}
+	if len(op.Errors) != 4 || op.Errors["gone"] != http.StatusNotFound {
+		t.Errorf("unexpected errors %v", op.Errors)
+	}
+}
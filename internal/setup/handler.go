@@ -0,0 +1,312 @@
+package setup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/rest-api/internal/auth"
+	"github.com/rest-api/internal/logger"
+	"github.com/rest-api/internal/ratelimit"
+)
+
+// Empty is used as the Req or Resp type for endpoints
+// that don't have a request or response body
+type Empty struct{}
+
+// TypedFunc is a handler func that works with decoded request
+// and response types instead of the http request and response writer
+type TypedFunc[Req, Resp any] func(ctx context.Context, req Req) (Resp, error)
+
+const endpointKey Key = "endpoint"
+
+// EndpointFromContext returns the endpoint that matched the request
+func EndpointFromContext(ctx context.Context) (e Endpoint, found bool) {
+	e, found = ctx.Value(endpointKey).(Endpoint)
+	return e, found
+}
+
+// handler wraps the endpoint's HandlerFunc to add the endpoint to the request context,
+// rate limit, authenticate and authorize the request and validate the path and query params
+// before the HandlerFunc is called. Errors are written in the endpoint's ErrorFormat
+func (e Endpoint) handler() http.Handler {
+	policy, scope := e.rateLimit()
+	// requests limited by principal or api key are counted after they are authenticated
+	afterAuth := policy.KeyBy.AfterAuth() && len(e.Auth) > 0
+	format := errorFormat(e.ErrorFormat)
+
+	h := Handler(func(w http.ResponseWriter, r *http.Request) error {
+		ctx := r.Context()
+		if l, ok := ctx.Value(logger.RequestKey).(*logger.Log); ok {
+			l.Redact, l.Capture = e.Redact, e.Capture
+		}
+		if policy.Enabled() {
+			// requests counted after auth are limited by ip first so the
+			// credentials (bcrypt for basic auth) aren't checked for every request
+			pre := policy
+			if afterAuth {
+				pre = &ratelimit.Policy{Limit: policy.Limit, Window: policy.Window, Burst: policy.Burst, KeyBy: ratelimit.IP}
+			}
+			if err := limit(w, r, pre, scope, nil); err != nil {
+				return err
+			}
+		}
+
+		if len(e.Auth) > 0 {
+			p, err := authenticate(w, r, e.Auth)
+			if err != nil {
+				return err
+			}
+			if policy.Enabled() && afterAuth {
+				if err := limit(w, r, policy, scope, p); err != nil {
+					return err
+				}
+			}
+			if err := authorize(p, e.Scopes); err != nil {
+				return err
+			}
+			ctx = auth.WithPrincipal(ctx, p)
+		}
+
+		ps, err := checkParams(r, e)
+		if err != nil {
+			return err
+		}
+
+		ctx = context.WithValue(ctx, endpointKey, e)
+		ctx = context.WithValue(ctx, paramsKey, ps)
+		return e.HandlerFunc(w, r.WithContext(ctx))
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, format)
+	})
+}
+
+// rateLimit returns the endpoint's policy or the global policy when the endpoint doesn't have one,
+// the scope keeps an endpoint's buckets separate from the global buckets
+func (e Endpoint) rateLimit() (*ratelimit.Policy, string) {
+	if e.RateLimit != nil {
+		return e.RateLimit, fmt.Sprint(e.Methods, e.FullPath)
+	}
+	if apiConfig != nil && apiConfig.RateLimit != nil {
+		return apiConfig.RateLimit, "global"
+	}
+	return &ratelimit.Policy{}, ""
+}
+
+// limit takes a token for the request and sets the rate limit headers,
+// requests over the limit get a 429 APIErr. The request is allowed if the store fails
+func limit(w http.ResponseWriter, r *http.Request, policy *ratelimit.Policy, scope string, p *auth.Principal) error {
+	res, err := ratelimit.Take(r, scope, *policy, p)
+	if err != nil {
+		logger.Ctx(r.Context()).Error("rate limit store", "error", err)
+		return nil
+	}
+
+	res.Headers(w.Header())
+	if !res.Allowed {
+		return &logger.APIErr{
+			Internal: logger.Internal{
+				Msg: fmt.Sprintf("rate limit exceeded for %s (%d per %v)", ratelimit.Key(r, policy.KeyBy, p), policy.Limit, policy.Window),
+			},
+			RespBody: logger.RespBody{
+				Msg:  "too many requests",
+				Code: http.StatusTooManyRequests,
+			},
+		}
+	}
+	return nil
+}
+
+// authenticate checks the request's credentials against the endpoint's auth methods,
+// the principal is added to the request log and failures are returned as a 401 APIErr
+func authenticate(w http.ResponseWriter, r *http.Request, methods auth.Methods) (*auth.Principal, error) {
+	p, err := auth.Authenticate(r, methods)
+	if err != nil {
+		if c := auth.Challenge(methods); c != "" {
+			w.Header().Set("WWW-Authenticate", c)
+		}
+		return nil, &logger.APIErr{
+			Internal: logger.Internal{Msg: "authentication failed", Err: err, ErrText: err.Error()},
+			RespBody: logger.RespBody{
+				Msg:  "authentication required",
+				Code: http.StatusUnauthorized,
+			},
+		}
+	}
+
+	if l, ok := r.Context().Value(logger.RequestKey).(*logger.Log); ok {
+		l.Principal = string(p.Method) + ":" + p.Subject
+	}
+	return p, nil
+}
+
+// authorize checks the principal has all of the scopes,
+// a principal missing any of them gets a 403 APIErr
+func authorize(p *auth.Principal, scopes []string) error {
+	missing := p.Missing(scopes)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return &logger.APIErr{
+		Internal: logger.Internal{
+			Msg: fmt.Sprintf("%s:%s is missing scopes %s", p.Method, p.Subject, strings.Join(missing, ", ")),
+		},
+		RespBody: logger.RespBody{
+			Msg:  "insufficient permissions",
+			Code: http.StatusForbidden,
+		},
+	}
+}
+
+// authEnabled returns true when at least one of the methods is configured
+func authEnabled(methods auth.Methods) bool {
+	for _, m := range methods {
+		if auth.Enabled(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Typed returns a Handler that decodes the request body into Req, binds the
+// path and query params to the Req fields tagged with path or query, calls fn and
+// encodes the returned Resp with the encoder negotiated from the Accept header (see Write).
+// The request body is decoded using its Content-Type, the RequestType is used when it's not set.
+// The response is written with the endpoint's SuccessCode (200 by default),
+// a request body that can't be decoded is returned as a 400 APIErr, an unsupported
+// Content-Type as a 415 APIErr and a body that fails validation is returned as a 422 APIErr
+func Typed[Req, Resp any](fn TypedFunc[Req, Resp]) Handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		e, _ := EndpointFromContext(r.Context())
+
+		var req Req
+		if _, empty := any(req).(Empty); !empty {
+			raw, err := decode(r, e, &req)
+			if err != nil {
+				return err
+			}
+			if err := validateBody(e, raw, req); err != nil {
+				return err
+			}
+			if err := Bind(r, &req); err != nil {
+				return err
+			}
+		}
+
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			return err
+		}
+
+		code := e.SuccessCode
+		if code == 0 {
+			code = http.StatusOK
+		}
+
+		if _, empty := any(resp).(Empty); empty {
+			w.WriteHeader(code)
+			return nil
+		}
+		return Write(w, r, code, resp)
+	}
+}
+
+// HeaderSetter is a response that sets its own headers when it's written
+// i.e., the Link header of a listquery.Page
+type HeaderSetter interface {
+	SetHeaders(r *http.Request, h http.Header)
+}
+
+// Write encodes v with the endpoint's media type that best matches the Accept header
+// and writes it with the status code, the ResponseType is used when any type is accepted.
+// A 406 APIErr is returned when none of the types the endpoint produces are accepted
+func Write(w http.ResponseWriter, r *http.Request, code int, v any) error {
+	e, _ := EndpointFromContext(r.Context())
+	offers := e.produces(v)
+	mt, ok := negotiate(r.Header.Get("Accept"), offers)
+	if !ok {
+		return &logger.APIErr{
+			Internal: logger.Internal{Msg: fmt.Sprintf("no acceptable response type for %q", r.Header.Get("Accept"))},
+			RespBody: logger.RespBody{
+				Msg:  "the response can be returned as " + strings.Join(offers, ", "),
+				Code: http.StatusNotAcceptable,
+			},
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := encoders[mt].Encode(&buf, v, e.Pretty); err != nil {
+		return fmt.Errorf("%s marshal error for response body %w", mt, err)
+	}
+
+	if hs, ok := v.(HeaderSetter); ok {
+		hs.SetHeaders(r, w.Header())
+	}
+	w.Header().Set("Content-Type", mt)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+	return nil
+}
+
+// decode reads the request body into v with the decoder for its Content-Type and returns the
+// body's fields for the JSONFields checks, an empty body leaves v as its zero value
+func decode(r *http.Request, e Endpoint, v any) (map[string]any, error) {
+	raw := make(map[string]any)
+	if r.Body == nil {
+		return raw, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, logger.NewError(err.Error(), "could not read request body", http.StatusBadRequest, err)
+	}
+	if len(body) == 0 {
+		return raw, nil
+	}
+
+	mt := contentType(e.RequestType)
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, _ = mime.ParseMediaType(ct)
+	}
+	var dec Decoder
+	for _, t := range e.consumes() {
+		if t == mt {
+			dec, _ = encoders[t].(Decoder)
+		}
+	}
+	if dec == nil {
+		return nil, &logger.APIErr{
+			Internal: logger.Internal{Msg: fmt.Sprintf("unsupported request content type %q", mt)},
+			RespBody: logger.RespBody{
+				Msg:  "the request body can be sent as " + strings.Join(e.consumes(), ", "),
+				Code: http.StatusUnsupportedMediaType,
+			},
+		}
+	}
+
+	if err := dec.Decode(body, v); err != nil {
+		return nil, logger.NewError(err.Error(), "could not parse request body", http.StatusBadRequest, err)
+	}
+
+	// decoders that can't decode into a map i.e., xml return the fields that were sent.
+	// A json body that isn't an object has no fields, other decoders that can't decode
+	// into a map (protobuf) have every field of the decoded value as the body has no field presence
+	if fd, ok := dec.(FieldDecoder); ok {
+		if raw, err = fd.Fields(body, v); err != nil {
+			return nil, logger.NewError(err.Error(), "could not parse request body", http.StatusBadRequest, err)
+		}
+		return raw, nil
+	}
+	if err := dec.Decode(body, &raw); err != nil && mt != ContentJSON {
+		b, _ := json.Marshal(v)
+		json.Unmarshal(b, &raw)
+	}
+	return raw, nil
+}
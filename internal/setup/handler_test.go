@@ -0,0 +1,200 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rest-api/internal/auth"
+	"github.com/rest-api/internal/logger"
+	"github.com/rest-api/internal/ratelimit"
+)
+
+type xmlKitten struct {
+	ID    int    `json:"id,omitempty" xml:"id,attr"`
+	Name  string `json:"name"`
+	Breed string `json:"breed"`
+	Toys  []struct {
+		Kind string `json:"kind"`
+	} `json:"toys" xml:"toys>toy"`
+}
+
+func TestDecodeXMLRequired(t *testing.T) {
+	e := Endpoint{
+		RequestType: ContentJSON,
+		JSONFields: []Param{
+			{Name: "name", Required: true},
+			{Name: "breed", Required: true},
+		},
+	}
+
+	cases := map[string]struct {
+		body    string
+		missing []string
+	}{
+		"all fields":    {body: `<xmlKitten id="1"><Name>Tom</Name><Breed>tabby</Breed></xmlKitten>`},
+		"empty element": {body: `<xmlKitten><Name/><Breed>tabby</Breed></xmlKitten>`},
+		"missing breed": {body: `<xmlKitten><Name>Tom</Name></xmlKitten>`, missing: []string{"breed"}},
+		"empty body":    {body: `<xmlKitten/>`, missing: []string{"name", "breed"}},
+		"json names":    {body: `<xmlKitten><name>Tom</name><breed>tabby</breed></xmlKitten>`, missing: []string{"name", "breed"}},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(c.body))
+			r.Header.Set("Content-Type", ContentXML)
+
+			var k xmlKitten
+			raw, err := decode(r, e, &k)
+			if err != nil {
+				t.Fatalf("decode %v", err)
+			}
+			err = validateBody(e, raw, k)
+			if len(c.missing) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+
+			var apiErr *logger.APIErr
+			if !errors.As(err, &apiErr) || apiErr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("expected a 422 APIErr, got %v", err)
+			}
+			if len(apiErr.Errors) != len(c.missing) {
+				t.Fatalf("expected %d errors, got %v", len(c.missing), apiErr.Errors)
+			}
+			for i, f := range c.missing {
+				if apiErr.Errors[i].Field != f || apiErr.Errors[i].Reason != "is required" {
+					t.Errorf("expected %s is required, got %v", f, apiErr.Errors[i])
+				}
+			}
+		})
+	}
+}
+
+func TestXMLFields(t *testing.T) {
+	body := `<xmlKitten id="3"><Name>Tom</Name><toys><toy><Kind>ball</Kind></toy><toy/></toys></xmlKitten>`
+	fields, err := xmlEncoder{}.Fields([]byte(body), &xmlKitten{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fields["id"] != "3" || fields["name"] != "Tom" {
+		t.Errorf("expected the id attr and name, got %v", fields)
+	}
+	if _, found := fields["breed"]; found {
+		t.Errorf("breed wasn't sent %v", fields)
+	}
+	toys, _ := fields["toys"].([]any)
+	if len(toys) != 2 {
+		t.Fatalf("expected 2 toys, got %v", fields["toys"])
+	}
+	if toy, _ := toys[0].(map[string]any); toy["kind"] != "ball" {
+		t.Errorf("expected the first toy kind, got %v", toys[0])
+	}
+}
+
+func TestScopes(t *testing.T) {
+	defer auth.Init(nil)
+	err := auth.Init(&auth.Options{APIKeys: []auth.APIKeyUser{
+		{Key: "reader", Subject: "reporting", Scopes: []string{"kittns:read"}},
+		{Key: "admin", Subject: "ops", Scopes: []string{"kittns:read", "kittns:delete"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := Endpoint{
+		FullPath: "/v1/kittns/{id}", Methods: Methods{DELETE},
+		Auth:   auth.Methods{auth.Basic, auth.APIKey},
+		Scopes: []string{"kittns:delete"},
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) error {
+			p, _ := auth.FromContext(r.Context())
+			w.Write([]byte(p.Subject))
+			return nil
+		},
+	}
+	h := e.handler()
+
+	cases := map[string]struct {
+		key       string
+		code      int
+		body      string
+		principal string
+	}{
+		"no key":         {code: http.StatusUnauthorized, body: "authentication required"},
+		"bad key":        {key: "nope", code: http.StatusUnauthorized, body: "authentication required"},
+		"missing scope":  {key: "reader", code: http.StatusForbidden, body: "insufficient permissions", principal: "api_key:reporting"},
+		"has the scopes": {key: "admin", code: http.StatusOK, body: "ops", principal: "api_key:ops"},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := &logger.Log{}
+			r := httptest.NewRequest(http.MethodDelete, "/v1/kittns/1", nil)
+			r = r.WithContext(context.WithValue(r.Context(), logger.RequestKey, req))
+			if c.key != "" {
+				r.Header.Set(auth.DefaultAPIKeyHeader, c.key)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != c.code || !strings.Contains(w.Body.String(), c.body) {
+				t.Errorf("expected %d %s, got %d %s", c.code, c.body, w.Code, w.Body)
+			}
+			if req.Principal != c.principal {
+				t.Errorf("expected the principal %q on the request log, got %q", c.principal, req.Principal)
+			}
+			if c.code == http.StatusForbidden && !strings.Contains(req.APIError.Msg, "missing scopes kittns:delete") {
+				t.Errorf("expected the missing scopes to be logged, got %+v", req.APIError)
+			}
+			if c.code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") != `Basic realm="api"` {
+				t.Errorf("expected the basic challenge, got %q", w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+// countValidator counts the requests it authenticates
+type countValidator struct{ calls int }
+
+func (v *countValidator) Authenticate(*http.Request) (*auth.Principal, error) {
+	v.calls++
+	return nil, errors.New("invalid username or password")
+}
+
+func TestRateLimitBeforeAuth(t *testing.T) {
+	defer auth.Init(nil)
+	v := &countValidator{}
+	auth.Register(auth.Basic, v)
+
+	e := Endpoint{
+		FullPath: "/v1/limited", Methods: Methods{POST}, Auth: auth.Methods{auth.Basic},
+		RateLimit:   &ratelimit.Policy{Limit: 2, Window: time.Minute, KeyBy: ratelimit.Principal},
+		HandlerFunc: func(http.ResponseWriter, *http.Request) error { return nil },
+	}
+	h := e.handler()
+
+	codes := make([]int, 0)
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/v1/limited", nil)
+		r = r.WithContext(context.WithValue(r.Context(), logger.RequestKey, &logger.Log{}))
+		r.SetBasicAuth("admin", "guess")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		codes = append(codes, w.Code)
+	}
+
+	want := []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}
+	if !reflect.DeepEqual(codes, want) {
+		t.Errorf("expected %v, got %v", want, codes)
+	}
+	if v.calls != 2 {
+		t.Errorf("expected the limited request not to be authenticated, got %d calls", v.calls)
+	}
+}
@@ -0,0 +1,132 @@
+package setup
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckFunc reports an unhealthy dependency by returning an error
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named health check, liveness checks are run by the liveness probe,
+// all checks are run by the readiness probe and status
+type Check struct {
+	Name     string
+	Timeout  time.Duration // the check fails when it runs longer than the timeout (default 5s)
+	Liveness bool          // failing the check means the process needs to be restarted
+	Fn       CheckFunc
+}
+
+// CheckResult is the outcome of a single health check
+type CheckResult struct {
+	Status  string  `json:"status"`
+	Error   string  `json:"error,omitempty"`
+	Latency float64 `json:"latency"`
+}
+
+// Health is the overall status and the result of each check
+type Health struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+const (
+	StatusOK       = "ok"
+	StatusFail     = "fail"
+	StatusShutdown = "shutting down"
+
+	defaultCheckTimeout = 5 * time.Second
+)
+
+var (
+	checks   []Check
+	draining int32 // set to 1 when a graceful shutdown starts
+)
+
+// AddCheck registers a health check, checks are run concurrently
+func AddCheck(c Check) {
+	checks = append(checks, c)
+}
+
+// Draining returns true once a graceful shutdown has started
+func Draining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// SetDraining marks the api as shutting down so the readiness probe fails,
+// Serve sets it when a shutdown signal is received
+func SetDraining(d bool) {
+	var v int32
+	if d {
+		v = 1
+	}
+	atomic.StoreInt32(&draining, v)
+}
+
+// RunChecks runs the registered checks, only the liveness checks are run when liveness is true
+func RunChecks(ctx context.Context, liveness bool) Health {
+	h := Health{Status: StatusOK, Checks: make(map[string]CheckResult)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		if liveness && !c.Liveness {
+			continue
+		}
+		wg.Add(1)
+		go func(c Check) {
+			defer wg.Done()
+			res := c.run(ctx)
+			mu.Lock()
+			h.Checks[c.Name] = res
+			if res.Status != StatusOK {
+				h.Status = StatusFail
+			}
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	return h
+}
+
+// Ready runs all the checks, readiness fails once a graceful shutdown has started
+// so load balancers stop sending new requests
+func Ready(ctx context.Context) Health {
+	h := RunChecks(ctx, false)
+	if Draining() {
+		h.Status = StatusShutdown
+	}
+	return h
+}
+
+// run calls the check with its timeout, a check that doesn't
+// return before the timeout is failed
+func (c Check) run(ctx context.Context) CheckResult {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- c.Fn(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := CheckResult{Status: StatusOK, Latency: time.Since(start).Seconds()}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
@@ -0,0 +1,380 @@
+package setup
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rest-api/internal/listquery"
+	"github.com/rest-api/internal/logger"
+)
+
+// ParamType is the value type of a path or query param
+type ParamType uint
+
+const (
+	String ParamType = iota // default
+	Int
+	Bool
+	Float
+	UUID
+	Time // RFC3339 or 2006-01-02
+	Enum // one of Param.Enum
+)
+
+const paramsKey Key = "params"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var uuidRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func (pt ParamType) String() string {
+	switch pt {
+	case Int:
+		return "int"
+	case Bool:
+		return "bool"
+	case Float:
+		return "float"
+	case UUID:
+		return "uuid"
+	case Time:
+		return "time"
+	case Enum:
+		return "enum"
+	default:
+		return "string"
+	}
+}
+
+// goType is the type a value of the param is parsed as
+func (pt ParamType) goType() reflect.Type {
+	switch pt {
+	case Int:
+		return reflect.TypeOf(int64(0))
+	case Bool:
+		return reflect.TypeOf(false)
+	case Float:
+		return reflect.TypeOf(float64(0))
+	case Time:
+		return timeType
+	default:
+		return reflect.TypeOf("")
+	}
+}
+
+// parse converts the string value to the param's type
+func (p Param) parse(s string) (v any, err error) {
+	switch p.Type {
+	case Int:
+		if v, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+	case Bool:
+		if v, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+	case Float:
+		if v, err = strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+	case UUID:
+		if !uuidRegex.MatchString(s) {
+			return nil, fmt.Errorf("must be a uuid")
+		}
+		v = s
+	case Time:
+		return parseTime(s)
+	case Enum:
+		for _, e := range p.Enum {
+			if e == s {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(p.Enum, ", "))
+	default:
+		v = s
+	}
+	return v, nil
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", s)
+	}
+	if err != nil {
+		return t, fmt.Errorf("must be an RFC3339 time or a 2006-01-02 date")
+	}
+	return t, nil
+}
+
+var listType = reflect.TypeOf(listquery.Query{})
+
+// params holds the raw values for the endpoint's path and query params
+// after defaults have been applied, list is set for endpoints with a List spec
+type params struct {
+	path  map[string]string
+	query map[string][]string
+	list  *listquery.Query
+}
+
+// checkParams validates the request's path and query params against
+// the endpoint's PathParams and QueryParams, all failures are returned in a single 400 APIErr
+func checkParams(r *http.Request, e Endpoint) (params, error) {
+	var errs []logger.FieldError
+	ps := params{path: make(map[string]string), query: r.URL.Query()}
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		for i, k := range rctx.URLParams.Keys {
+			ps.path[k] = rctx.URLParams.Values[i]
+		}
+	}
+
+	check := func(p Param, values []string) {
+		for _, v := range values {
+			val, err := p.parse(v)
+			if err != nil {
+				errs = append(errs, logger.FieldError{Field: p.Name, Reason: err.Error()})
+				continue
+			}
+			if p.Validate != "" {
+				errs = append(errs, checkRules(reflect.ValueOf(val), p.Name, p.Validate)...)
+			}
+		}
+	}
+
+	for _, p := range e.PathParams {
+		check(p, []string{ps.path[p.Name]})
+	}
+
+	for _, p := range e.QueryParams {
+		values, found := ps.query[p.Name]
+		if !found || len(values) == 0 || values[0] == "" {
+			if p.Default != "" {
+				ps.query[p.Name] = []string{p.Default}
+				continue
+			}
+			if p.Required {
+				errs = append(errs, logger.FieldError{Field: p.Name, Reason: "is required"})
+			}
+			continue
+		}
+		check(p, values)
+	}
+
+	// the list params are parsed once the param types are valid so the errors aren't repeated
+	if e.List != nil && len(errs) == 0 {
+		q, lerrs := e.List.Parse(ps.query)
+		errs = append(errs, lerrs...)
+		ps.list = &q
+	}
+
+	if len(errs) > 0 {
+		return ps, &logger.APIErr{
+			Internal: logger.Internal{Msg: fmt.Sprintf("invalid request params %v", errs)},
+			RespBody: logger.RespBody{
+				Msg:    "invalid request params",
+				Code:   http.StatusBadRequest,
+				Errors: errs,
+			},
+		}
+	}
+
+	return ps, nil
+}
+
+// Bind fills the fields of the struct v tagged with `path:"name"` or `query:"name"`
+// from the request's params, the params are validated against the endpoint's
+// PathParams and QueryParams and defaults are applied. Invalid input is returned as a 400 APIErr.
+// The parsed list params of an endpoint with a List spec are bound to a *listquery.Query
+// or to the struct's listquery.Query field. The fields of embedded structs are bound too
+//
+//	type kittnReq struct {
+//		ID    int    `path:"id"`
+//		Breed string `query:"breed"`
+//	}
+func Bind(r *http.Request, v any) error {
+	ps, found := r.Context().Value(paramsKey).(params)
+	if !found {
+		e, _ := EndpointFromContext(r.Context())
+		var err error
+		if ps, err = checkParams(r, e); err != nil {
+			return err
+		}
+	}
+	return ps.bind(v)
+}
+
+// bind sets the tagged struct fields from the params
+func (ps params) bind(v any) error {
+	if q, ok := v.(*listquery.Query); ok {
+		if ps.list != nil {
+			*q = *ps.list
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	errs := ps.bindFields(rv.Elem(), nil)
+	if len(errs) > 0 {
+		return &logger.APIErr{
+			Internal: logger.Internal{Msg: fmt.Sprintf("invalid request params %v", errs)},
+			RespBody: logger.RespBody{
+				Msg:    "invalid request params",
+				Code:   http.StatusBadRequest,
+				Errors: errs,
+			},
+		}
+	}
+	return nil
+}
+
+// bindFields sets the tagged fields of the struct value, the fields of
+// untagged embedded structs are set the same way, a nil embedded pointer is allocated
+func (ps params) bindFields(rv reflect.Value, errs []logger.FieldError) []logger.FieldError {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type != listType && sf.Tag.Get("path") == "" && sf.Tag.Get("query") == "" {
+			f := rv.Field(i)
+			if f.Kind() == reflect.Pointer && f.Type().Elem().Kind() == reflect.Struct {
+				if f.IsNil() {
+					if !f.CanSet() {
+						continue // an unexported embedded pointer can't be allocated
+					}
+					f.Set(reflect.New(f.Type().Elem()))
+				}
+				f = f.Elem()
+			}
+			if f.Kind() == reflect.Struct {
+				errs = ps.bindFields(f, errs)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if sf.Type == listType {
+			if ps.list != nil {
+				rv.Field(i).Set(reflect.ValueOf(*ps.list))
+			}
+			continue
+		}
+
+		var values []string
+		name := sf.Tag.Get("path")
+		if name != "" {
+			if v, found := ps.path[name]; found {
+				values = []string{v}
+			}
+		} else if name = sf.Tag.Get("query"); name != "" {
+			values = ps.query[name]
+		} else {
+			continue
+		}
+
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(rv.Field(i), values); err != nil {
+			errs = append(errs, logger.FieldError{Field: name, Reason: err.Error()})
+		}
+	}
+	return errs
+}
+
+// setField converts the string values into the field's type
+func setField(f reflect.Value, values []string) error {
+	if f.Kind() == reflect.Pointer {
+		if f.IsNil() {
+			f.Set(reflect.New(f.Type().Elem()))
+		}
+		return setField(f.Elem(), values)
+	}
+
+	s := values[0]
+	if f.Type() == timeType {
+		t, err := parseTime(s)
+		if err != nil {
+			return err
+		}
+		f.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if f.CanAddr() {
+		if u, ok := f.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid bool value %q", s)
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid int value %q", s)
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid uint value %q", s)
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid float value %q", s)
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		sl := reflect.MakeSlice(f.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := setField(sl.Index(i), []string{v}); err != nil {
+				return err
+			}
+		}
+		f.Set(sl)
+	default:
+		return fmt.Errorf("unsupported param type %s", f.Type())
+	}
+
+	return nil
+}
+
+// listParams are the list spec's query params as Params for the param checks and the api docs
+func listParams(s *listquery.Spec) []Param {
+	var ps []Param
+	for _, p := range s.Params() {
+		param := Param{Name: p.Name, Description: p.Description, Default: p.Default}
+		switch p.Type {
+		case listquery.Int:
+			param.Type = Int
+		case listquery.Float:
+			param.Type = Float
+		case listquery.Bool:
+			param.Type = Bool
+		case listquery.Time:
+			param.Type = Time
+		}
+		ps = append(ps, param)
+	}
+	return ps
+}
@@ -0,0 +1,189 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rest-api/internal/listquery"
+	"github.com/rest-api/internal/logger"
+)
+
+// paramsRequest returns a request for the endpoint with the chi path params
+func paramsRequest(e Endpoint, target string, path map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	rctx := chi.NewRouteContext()
+	for k, v := range path {
+		rctx.URLParams.Add(k, v)
+	}
+	ctx := context.WithValue(r.Context(), chi.RouteCtxKey, rctx)
+	return r.WithContext(context.WithValue(ctx, endpointKey, e))
+}
+
+func fieldErrors(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var apiErr *logger.APIErr
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest {
+		t.Fatalf("expected a 400 APIErr, got %v", err)
+	}
+	m := make(map[string]string)
+	for _, fe := range apiErr.Errors {
+		m[fe.Field] = fe.Reason
+	}
+	return m
+}
+
+func TestParamParse(t *testing.T) {
+	cases := []struct {
+		p    Param
+		in   string
+		want any
+		err  bool
+	}{
+		{p: Param{Type: Int}, in: "42", want: int64(42)},
+		{p: Param{Type: Int}, in: "4.2", err: true},
+		{p: Param{Type: Bool}, in: "true", want: true},
+		{p: Param{Type: Float}, in: "1.5", want: 1.5},
+		{p: Param{Type: UUID}, in: "0b6e9a3c-3f0e-4bb7-9c3e-3b8f1f6c1a2d", want: "0b6e9a3c-3f0e-4bb7-9c3e-3b8f1f6c1a2d"},
+		{p: Param{Type: UUID}, in: "123", err: true},
+		{p: Param{Type: Time}, in: "2024-01-02", want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{p: Param{Type: Time}, in: "yesterday", err: true},
+		{p: Param{Type: Enum, Enum: []string{"a", "b"}}, in: "b", want: "b"},
+		{p: Param{Type: Enum, Enum: []string{"a", "b"}}, in: "c", err: true},
+		{p: Param{}, in: "any", want: "any"},
+	}
+	for _, c := range cases {
+		got, err := c.p.parse(c.in)
+		if (err != nil) != c.err || (!c.err && !reflect.DeepEqual(got, c.want)) {
+			t.Errorf("%s %q expected %v %v, got %v %v", c.p.Type, c.in, c.want, c.err, got, err)
+		}
+	}
+}
+
+type bindReq struct {
+	ID     int       `path:"id"`
+	Breed  string    `query:"breed"`
+	Limit  *int      `query:"limit"`
+	Since  time.Time `query:"since"`
+	Tags   []string  `query:"tag"`
+	Ignore string
+	List   listquery.Query
+}
+
+func TestBind(t *testing.T) {
+	e := Endpoint{
+		PathParams: []Param{{Name: "id", Type: Int, Validate: "min=1"}},
+		QueryParams: []Param{
+			{Name: "breed", Default: "calico"},
+			{Name: "limit", Type: Int, Validate: "max=50"},
+			{Name: "since", Type: Time},
+			{Name: "tag"},
+		},
+	}
+
+	r := paramsRequest(e, "/?limit=10&since=2024-01-02&tag=a&tag=b", map[string]string{"id": "7"})
+	var req bindReq
+	if err := Bind(r, &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.ID != 7 || req.Breed != "calico" || req.Limit == nil || *req.Limit != 10 || req.Since.Day() != 2 || len(req.Tags) != 2 {
+		t.Errorf("unexpected bind %+v", req)
+	}
+
+	r = paramsRequest(e, "/?limit=100&since=soon", map[string]string{"id": "0"})
+	errs := fieldErrors(t, Bind(r, &bindReq{}))
+	want := map[string]string{"id": "must be at least 1", "limit": "must be at most 50", "since": "must be an RFC3339 time or a 2006-01-02 date"}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("expected %v, got %v", want, errs)
+	}
+
+	required := Endpoint{QueryParams: []Param{{Name: "q", Required: true}}}
+	if errs := fieldErrors(t, Bind(paramsRequest(required, "/", nil), &bindReq{})); errs["q"] != "is required" {
+		t.Errorf("expected q to be required, got %v", errs)
+	}
+}
+
+type pageParams struct {
+	Limit int `query:"limit"`
+	Page  int `query:"page"`
+}
+
+// BreedParams is exported so the embedded pointer can be allocated
+type BreedParams struct {
+	Breed string `query:"breed"`
+}
+
+func TestBindEmbedded(t *testing.T) {
+	e := Endpoint{
+		PathParams:  []Param{{Name: "id", Type: Int}},
+		QueryParams: []Param{{Name: "limit", Type: Int}, {Name: "breed", Default: "calico"}},
+	}
+	var req struct {
+		pageParams
+		*BreedParams
+		ID int `path:"id"`
+	}
+	if err := Bind(paramsRequest(e, "/?limit=10", map[string]string{"id": "7"}), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.ID != 7 || req.Limit != 10 || req.BreedParams == nil || req.Breed != "calico" {
+		t.Errorf("expected the embedded fields to be bound, got %+v %+v", req, req.BreedParams)
+	}
+
+	var bad struct{ pageParams }
+	if errs := fieldErrors(t, Bind(paramsRequest(Endpoint{}, "/?page=x", nil), &bad)); errs["page"] == "" {
+		t.Errorf("expected an embedded field error, got %v", errs)
+	}
+}
+
+func TestBindList(t *testing.T) {
+	spec := &listquery.Spec{Fields: []listquery.Field{{Name: "id", Type: listquery.Int, Sort: true}}, DefaultSort: "id"}
+	e := Endpoint{List: spec}
+
+	var q listquery.Query
+	if err := Bind(paramsRequest(e, "/?limit=5", nil), &q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Limit != 5 || len(q.Sort) != 1 {
+		t.Errorf("unexpected list query %+v", q)
+	}
+
+	var req bindReq
+	if err := Bind(paramsRequest(e, "/?offset=2", nil), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.List.Offset != 2 {
+		t.Errorf("expected the list field to be bound, got %+v", req.List)
+	}
+
+	if errs := fieldErrors(t, Bind(paramsRequest(e, "/?limit=0", nil), &q)); errs["limit"] == "" {
+		t.Errorf("expected a limit error, got %v", errs)
+	}
+}
+
+func TestSetField(t *testing.T) {
+	var v struct {
+		U uint8
+		F float32
+		B bool
+		M map[string]string
+	}
+	rv := reflect.ValueOf(&v).Elem()
+	if err := setField(rv.Field(0), []string{"300"}); err == nil {
+		t.Error("expected 300 to overflow a uint8")
+	}
+	if err := setField(rv.Field(1), []string{"1.5"}); err != nil || v.F != 1.5 {
+		t.Errorf("expected 1.5, got %v %v", v.F, err)
+	}
+	if err := setField(rv.Field(2), []string{"yes"}); err == nil {
+		t.Error("expected an invalid bool")
+	}
+	if err := setField(rv.Field(3), []string{"x"}); err == nil {
+		t.Error("expected maps to be unsupported")
+	}
+}
@@ -0,0 +1,127 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// StartHook is called before the server starts listening,
+// an error will stop the server from starting
+type StartHook func() error
+
+// ShutdownHook is called after the server has stopped accepting requests
+// and in-flight requests have drained (or the drain period has passed)
+// use these to close db pools, flush request logs, etc...
+type ShutdownHook func(ctx context.Context) error
+
+var (
+	startHooks    []StartHook
+	shutdownHooks []ShutdownHook
+
+	// notify relays the signals that start a graceful shutdown
+	notify = func(c chan<- os.Signal) { signal.Notify(c, syscall.SIGINT, syscall.SIGTERM) }
+)
+
+// OnStart registers a hook to be run before the server starts listening
+// hooks are run in the order they are registered
+func OnStart(h StartHook) {
+	startHooks = append(startHooks, h)
+}
+
+// OnShutdown registers a hook to be run during a graceful shutdown
+// hooks are run in the reverse order they are registered
+func OnShutdown(h ShutdownHook) {
+	shutdownHooks = append(shutdownHooks, h)
+}
+
+// Serve runs the api http server until a SIGINT or SIGTERM is received
+// then drains in-flight requests for up to the configured ShutdownTimeout
+// before running the shutdown hooks. The shutdown hooks are also run when a
+// start hook fails so the resources opened by the earlier hooks are closed
+func Serve() error {
+	if apiConfig == nil {
+		return errors.New("config apiConfig is nil")
+	}
+
+	for _, h := range startHooks {
+		if err := h(); err != nil {
+			Shutdown(context.Background())
+			return fmt.Errorf("start hook error %w", err)
+		}
+	}
+
+	srv := &http.Server{
+		Addr:         fmt.Sprintf(":%d", apiConfig.Port),
+		Handler:      apiConfig.mux,
+		ReadTimeout:  apiConfig.ReadTimeout,
+		WriteTimeout: apiConfig.WriteTimeout,
+		IdleTimeout:  apiConfig.IdleTimeout,
+	}
+
+	sig := make(chan os.Signal, 1)
+	notify(sig)
+	defer signal.Stop(sig)
+
+	srvErr := make(chan error, 1)
+	go func() {
+		slog.Info("running api", "port", apiConfig.Port)
+		srvErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-srvErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			Shutdown(context.Background())
+			return fmt.Errorf("http server error %w", err)
+		}
+	case s := <-sig:
+		slog.Info("shutting down", "signal", s.String())
+		SetDraining(true)
+		if apiConfig.ShutdownDelay > 0 {
+			// keep serving while load balancers see the failing readiness probe
+			time.Sleep(apiConfig.ShutdownDelay)
+		}
+	}
+
+	ctx := context.Background()
+	if apiConfig.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, apiConfig.ShutdownTimeout)
+		defer cancel()
+	}
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		slog.Warn("server did not drain", "shutdown_timeout", apiConfig.ShutdownTimeout.String(), "error", err)
+	}
+	Shutdown(ctx)
+
+	return nil
+}
+
+// Shutdown runs the registered shutdown hooks once, errors are logged
+// so that every hook is given the chance to run. It's called by Serve,
+// call it before exiting when the server isn't started i.e., a setup error
+func Shutdown(ctx context.Context) {
+	// hooks get a fresh context if the drain period used up the old one
+	if ctx.Err() != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+	}
+
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			slog.Error("shutdown hook", "error", err)
+		}
+	}
+}
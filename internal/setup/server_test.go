@@ -0,0 +1,99 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// resetServer clears the hooks and config the tests register
+func resetServer(t *testing.T) {
+	prev := notify
+	t.Cleanup(func() {
+		startHooks, shutdownHooks, apiConfig, notify = nil, nil, nil, prev
+		SetDraining(false)
+	})
+}
+
+func TestStartHookError(t *testing.T) {
+	resetServer(t)
+	apiConfig = &Config{mux: chi.NewRouter()}
+
+	var calls []string
+	hook := func(name string, err error) StartHook {
+		return func() error {
+			calls = append(calls, "start "+name)
+			return err
+		}
+	}
+	closer := func(name string) ShutdownHook {
+		return func(context.Context) error {
+			calls = append(calls, "shutdown "+name)
+			return errors.New("hook errors are logged")
+		}
+	}
+	OnStart(hook("db", nil))
+	OnShutdown(closer("log"))
+	OnShutdown(closer("db"))
+	OnStart(hook("cache", errors.New("cache is down")))
+	OnStart(hook("routes", nil))
+
+	if err := Serve(); err == nil {
+		t.Fatal("expected the start hook error")
+	}
+	want := []string{"start db", "start cache", "shutdown db", "shutdown log"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("expected %v, got %v", want, calls)
+	}
+
+	// the hooks are only run once
+	Shutdown(context.Background())
+	if len(calls) != len(want) {
+		t.Errorf("expected the shutdown hooks to run once, got %v", calls)
+	}
+}
+
+func TestServeSignal(t *testing.T) {
+	resetServer(t)
+	apiConfig = &Config{mux: chi.NewRouter(), ShutdownDelay: 50 * time.Millisecond, ShutdownTimeout: time.Second}
+
+	sig := make(chan chan<- os.Signal, 1)
+	notify = func(c chan<- os.Signal) { sig <- c }
+
+	var drained bool
+	var deadline time.Time
+	OnShutdown(func(ctx context.Context) error {
+		drained = Draining()
+		deadline, _ = ctx.Deadline()
+		return nil
+	})
+
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() { done <- Serve() }()
+	(<-sig) <- syscall.SIGTERM
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server didn't shut down")
+	}
+	if elapsed := time.Since(start); elapsed < apiConfig.ShutdownDelay {
+		t.Errorf("expected to keep serving for the shutdown delay, stopped after %v", elapsed)
+	}
+	if !drained {
+		t.Error("expected the api to be draining when the shutdown hooks run")
+	}
+	if deadline.IsZero() || time.Until(deadline) > apiConfig.ShutdownTimeout {
+		t.Errorf("expected the hooks to get the shutdown timeout, got %v", deadline)
+	}
+}
@@ -0,0 +1,205 @@
+package setup
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/rest-api/internal/logger"
+	"github.com/rest-api/internal/openapi"
+	"github.com/rest-api/internal/validation"
+)
+
+// validateBody checks the decoded request body fields against the endpoint's required JSONFields
+// and the validate struct tags on v, every failure is returned in a single 422 APIErr
+func validateBody(e Endpoint, raw map[string]any, v any) error {
+	var errs []logger.FieldError
+	missing := make(map[string]bool)
+
+	if len(e.JSONFields) > 0 {
+		for _, f := range e.JSONFields {
+			if !f.Required {
+				continue
+			}
+			if val, found := lookup(raw, f.Name); !found || val == nil {
+				missing[f.Name] = true
+				errs = append(errs, logger.FieldError{Field: f.Name, Reason: "is required"})
+			}
+		}
+	}
+
+	for _, fe := range validateValue(reflect.ValueOf(v), "") {
+		if !missing[fe.Field] {
+			errs = append(errs, fe)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &logger.APIErr{
+		Internal: logger.Internal{Msg: fmt.Sprintf("request body validation failed %v", errs)},
+		RespBody: logger.RespBody{
+			Msg:    "request body validation failed",
+			Code:   http.StatusUnprocessableEntity,
+			Errors: errs,
+		},
+	}
+}
+
+// lookup finds a dot separated field name in the decoded json object
+func lookup(raw map[string]any, name string) (any, bool) {
+	var v any = raw
+	for _, key := range strings.Split(name, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// validateValue walks structs, slices and maps checking the validate tags
+func validateValue(v reflect.Value, path string) (errs []logger.FieldError) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fv := v.Field(i)
+			name, _ := openapi.JSONName(sf)
+			if name == "-" {
+				continue
+			}
+
+			fieldPath := name
+			if sf.Anonymous && name == sf.Name {
+				fieldPath = path // embedded fields are flattened into the parent
+			} else if path != "" {
+				fieldPath = path + "." + name
+			}
+
+			if tag := sf.Tag.Get(validation.Tag); tag != "" {
+				errs = append(errs, checkRules(fv, fieldPath, tag)...)
+			}
+			errs = append(errs, validateValue(fv, fieldPath)...)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			errs = append(errs, validateValue(iter.Value(), fmt.Sprintf("%s.%v", path, iter.Key()))...)
+		}
+	}
+
+	return errs
+}
+
+// checkRules validates a single field against its validate tag rules, the tags are checked
+// when the routes are validated so rules that don't parse or fit the value are skipped
+func checkRules(v reflect.Value, path, tag string) (errs []logger.FieldError) {
+	fail := func(format string, args ...any) {
+		errs = append(errs, logger.FieldError{Field: path, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	rules, err := validation.Parse(tag)
+	if err != nil {
+		return nil
+	}
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			if rules.Required() {
+				fail("is required")
+			}
+			return errs // optional values that are not set are not validated
+		}
+		v = v.Elem()
+	}
+
+	for _, r := range rules {
+		switch r.Key {
+		case "required":
+			if v.IsZero() {
+				fail("is required")
+			}
+		case "min", "max":
+			n, ok := number(v)
+			if !ok {
+				continue
+			}
+			if r.Key == "min" && n < r.Num {
+				fail("must be at least %s", r.Arg)
+			}
+			if r.Key == "max" && n > r.Num {
+				fail("must be at most %s", r.Arg)
+			}
+		case "len", "minlen", "maxlen":
+			if !validation.HasLen(v.Kind()) {
+				continue
+			}
+			l := v.Len()
+			if v.Kind() == reflect.String {
+				l = len([]rune(v.String()))
+			}
+			switch {
+			case r.Key == "len" && l != r.Len:
+				fail("length must be %d", r.Len)
+			case r.Key == "minlen" && l < r.Len:
+				fail("length must be at least %d", r.Len)
+			case r.Key == "maxlen" && l > r.Len:
+				fail("length must be at most %d", r.Len)
+			}
+		case "enum":
+			s := fmt.Sprint(v.Interface())
+			found := false
+			for _, o := range r.Enum {
+				if o == s {
+					found = true
+					break
+				}
+			}
+			if !found {
+				fail("must be one of %s", strings.Join(r.Enum, ", "))
+			}
+		case "regex":
+			if v.Kind() != reflect.String {
+				continue
+			}
+			if !r.Regex.MatchString(v.String()) {
+				fail("must match %s", r.Arg)
+			}
+		}
+	}
+
+	return errs
+}
+
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
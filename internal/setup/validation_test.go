@@ -0,0 +1,73 @@
+package setup
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rest-api/internal/logger"
+)
+
+type validKitten struct {
+	Name  string  `json:"name" validate:"required,minlen=1,maxlen=5"`
+	Breed string  `json:"breed" validate:"regex=^[a-z]*$"`
+	Cute  int     `json:"cuteness" validate:"min=0,max=10"`
+	Color string  `json:"color" validate:"enum=black|white"`
+	Owner *string `json:"owner" validate:"required"`
+}
+
+func TestValidateValue(t *testing.T) {
+	owner := "alice"
+	k := validKitten{Name: "Fluffums", Breed: "Tabby", Cute: 11, Color: "red", Owner: &owner}
+	got := make(map[string]string)
+	for _, fe := range validateValue(reflect.ValueOf(k), "") {
+		got[fe.Field] = fe.Reason
+	}
+
+	want := map[string]string{
+		"name":     "length must be at most 5",
+		"breed":    "must match ^[a-z]*$",
+		"cuteness": "must be at most 10",
+		"color":    "must be one of black, white",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for f, reason := range want {
+		if got[f] != reason {
+			t.Errorf("%s expected %q, got %q", f, reason, got[f])
+		}
+	}
+
+	errs := validateValue(reflect.ValueOf(validKitten{Name: "Tom", Color: "black"}), "")
+	if len(errs) != 1 || errs[0] != (logger.FieldError{Field: "owner", Reason: "is required"}) {
+		t.Errorf("expected only the nil owner to be required, got %v", errs)
+	}
+}
+
+func TestValidateTags(t *testing.T) {
+	cases := map[string]Endpoint{
+		"unknown rule": {RequestBody: struct {
+			Name string `validate:"minimum=1"`
+		}{}},
+		"rule type": {RequestBody: struct {
+			Name string `validate:"min=1"`
+		}{}},
+		"bad regex": {RequestBody: struct {
+			Name string `validate:"regex=[a-"`
+		}{}},
+		"param rule": {QueryParams: []Param{{Name: "breed", Validate: "max=10"}}},
+	}
+
+	for name, e := range cases {
+		t.Run(name, func(t *testing.T) {
+			e.Path, e.Methods, e.FullPath = "/", Methods{GET}, "/v1/test"
+			apiConfig = &Config{Routes: Endpoints{"test": e}}
+			defer func() { apiConfig = nil }()
+
+			if err := validate(); err == nil || !strings.Contains(err.Error(), "/v1/test") {
+				t.Errorf("expected the bad rule to fail the route validation, got %v", err)
+			}
+		})
+	}
+}
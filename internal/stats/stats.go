@@ -0,0 +1,191 @@
+// Package stats aggregates the request logs into per-route counts,
+// error rates and latency percentiles over rolling windows
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rest-api/internal/logger"
+)
+
+// buckets is the number of one minute buckets kept for each route,
+// it must cover the largest window
+const buckets = 15
+
+// maxSamples caps the latencies kept in a bucket, busy routes are sampled
+const maxSamples = 1000
+
+// windows are the rolling windows the route stats are reported for
+var windows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+type bucket struct {
+	minute    int64
+	count     int
+	errors    int // 5xx responses
+	latencies []float64
+}
+
+type route struct {
+	buckets [buckets]bucket
+}
+
+var (
+	mu      sync.Mutex
+	routes  = make(map[string]*route)
+	started = time.Now()
+)
+
+// Recorder implements logger.Observer to aggregate the request logs
+type Recorder struct{}
+
+func (Recorder) Start(_ *http.Request) {}
+
+func (Recorder) Finish(l *logger.Log) {
+	// unknown methods and routes are grouped so clients can't add routes to the stats
+	name := l.Route
+	if name == "" {
+		name = "unmatched"
+	}
+	record(logger.KnownMethod(l.Method)+" "+name, l.Time, l.Latency, l.RespCode >= http.StatusInternalServerError)
+}
+
+func record(name string, t time.Time, latency float64, isErr bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	r, found := routes[name]
+	if !found {
+		r = &route{}
+		routes[name] = r
+	}
+
+	minute := t.Unix() / 60
+	b := &r.buckets[minute%buckets]
+	if b.minute != minute {
+		*b = bucket{minute: minute, latencies: b.latencies[:0]}
+	}
+
+	b.count++
+	if isErr {
+		b.errors++
+	}
+	if len(b.latencies) < maxSamples {
+		b.latencies = append(b.latencies, latency)
+	} else if i := rand.Intn(b.count); i < maxSamples {
+		// reservoir sampling keeps an even sample of the bucket's requests
+		b.latencies[i] = latency
+	}
+}
+
+// Window is a route's aggregate over a rolling window, latencies are in seconds
+type Window struct {
+	Count     int     `json:"count"`
+	Errors    int     `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	P50       float64 `json:"p50"`
+	P95       float64 `json:"p95"`
+	P99       float64 `json:"p99"`
+}
+
+// Memory is a summary of runtime.MemStats in bytes
+type Memory struct {
+	Alloc      uint64 `json:"alloc"`
+	TotalAlloc uint64 `json:"total_alloc"`
+	Sys        uint64 `json:"sys"`
+	HeapInuse  uint64 `json:"heap_inuse"`
+	NumGC      uint32 `json:"num_gc"`
+}
+
+// Stats is a snapshot of the runtime and the route aggregates
+type Stats struct {
+	Uptime     string                       `json:"uptime"`
+	Goroutines int                          `json:"goroutines"`
+	Memory     Memory                       `json:"memory"`
+	Routes     map[string]map[string]Window `json:"routes"` // route -> window -> aggregate
+}
+
+// Snapshot returns the current stats
+func Snapshot() Stats {
+	ms := runtime.MemStats{}
+	runtime.ReadMemStats(&ms)
+
+	s := Stats{
+		Uptime:     time.Since(started).Round(time.Second).String(),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: Memory{
+			Alloc:      ms.Alloc,
+			TotalAlloc: ms.TotalAlloc,
+			Sys:        ms.Sys,
+			HeapInuse:  ms.HeapInuse,
+			NumGC:      ms.NumGC,
+		},
+		Routes: make(map[string]map[string]Window),
+	}
+
+	now := time.Now().Unix() / 60
+	mu.Lock()
+	defer mu.Unlock()
+	for name, r := range routes {
+		ws := make(map[string]Window)
+		for _, w := range windows {
+			if agg := r.window(now, int64(w/time.Minute)); agg.Count > 0 {
+				ws[windowName(w)] = agg
+			}
+		}
+		if len(ws) > 0 {
+			s.Routes[name] = ws
+		}
+	}
+
+	return s
+}
+
+// window aggregates the buckets for the last n minutes including the current minute
+func (r *route) window(now, n int64) Window {
+	w := Window{}
+	var latencies []float64
+	for _, b := range r.buckets {
+		if b.count == 0 || b.minute <= now-n || b.minute > now {
+			continue
+		}
+		w.Count += b.count
+		w.Errors += b.errors
+		latencies = append(latencies, b.latencies...)
+	}
+	if w.Count == 0 {
+		return w
+	}
+
+	w.ErrorRate = float64(w.Errors) / float64(w.Count)
+	sort.Float64s(latencies)
+	w.P50 = percentile(latencies, 0.50)
+	w.P95 = percentile(latencies, 0.95)
+	w.P99 = percentile(latencies, 0.99)
+	return w
+}
+
+// percentile uses the nearest rank of the sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func windowName(d time.Duration) string {
+	return strconv.Itoa(int(d.Minutes())) + "m"
+}
@@ -0,0 +1,62 @@
+package stats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rest-api/internal/logger"
+)
+
+func reset() {
+	mu.Lock()
+	routes = make(map[string]*route)
+	mu.Unlock()
+}
+
+func TestRecorderMethods(t *testing.T) {
+	reset()
+	now := time.Now()
+	for _, m := range []string{"FOO", "BAR", "BAZ", "GET"} {
+		Recorder{}.Finish(&logger.Log{Method: m, Time: now, RespCode: 405})
+	}
+
+	s := Snapshot()
+	if len(s.Routes) != 2 {
+		t.Fatalf("expected 2 routes, got %v", s.Routes)
+	}
+	if got := s.Routes["OTHER unmatched"]["1m"].Count; got != 3 {
+		t.Errorf("expected the 3 unknown methods to be grouped, got %d", got)
+	}
+	if got := s.Routes["GET unmatched"]["1m"].Count; got != 1 {
+		t.Errorf("expected 1 GET, got %d", got)
+	}
+}
+
+func TestWindows(t *testing.T) {
+	reset()
+	now := time.Now()
+	for i := 1; i <= 100; i++ {
+		record("GET /v1/kittns", now, float64(i), i > 90)
+	}
+	record("GET /v1/kittns", now.Add(-10*time.Minute), 500, false)
+
+	ws := Snapshot().Routes["GET /v1/kittns"]
+	if w := ws["1m"]; w.Count != 100 || w.Errors != 10 || w.ErrorRate != 0.1 {
+		t.Errorf("unexpected 1m window %+v", w)
+	}
+	if w := ws["1m"]; w.P50 != 50 || w.P95 != 95 || w.P99 != 99 {
+		t.Errorf("unexpected 1m percentiles %+v", w)
+	}
+	if w := ws["15m"]; w.Count != 101 {
+		t.Errorf("expected the 15m window to include the older request, got %+v", w)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Errorf("expected 0 for no values, got %v", got)
+	}
+	if got := percentile([]float64{1, 2, 3}, 0.99); got != 3 {
+		t.Errorf("expected the max, got %v", got)
+	}
+}
@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rest-api/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware starts a server span for each request, continuing the trace from the
+// traceparent header when there is one. The span is named after the matched route pattern
+// and the trace_id and span_id are added to the request log and the request's app logger.
+// It must be added after the request logger
+func Middleware(next http.Handler) http.Handler {
+	tracer := Tracer("http")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.Path),
+				attribute.String("http.user_agent", r.UserAgent()),
+				attribute.String("net.peer.addr", r.RemoteAddr),
+				attribute.String("http.request_id", middleware.GetReqID(r.Context())),
+			))
+		defer span.End()
+
+		req, _ := r.Context().Value(logger.RequestKey).(*logger.Log)
+		if sc := span.SpanContext(); sc.IsValid() {
+			if req != nil {
+				req.TraceID = sc.TraceID().String()
+				req.SpanID = sc.SpanID().String()
+			}
+			ctx = logger.WithLogger(ctx, logger.Ctx(ctx).With("trace_id", sc.TraceID().String(), "span_id", sc.SpanID().String()))
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(attribute.Int("http.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if req != nil && req.APIError != nil && req.APIError.Err != nil {
+			span.RecordError(req.APIError.Err)
+		}
+	})
+}
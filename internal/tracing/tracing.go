@@ -0,0 +1,123 @@
+// Package tracing sets up OpenTelemetry tracing, W3C traceparent headers are
+// extracted from incoming requests and injected into outbound requests
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// name is the instrumentation name used for the api's tracers
+const name = "github.com/rest-api"
+
+// Exporter values
+const (
+	None   = "none"
+	Stdout = "stdout"
+	File   = "file"
+	OTLP   = "otlp"
+)
+
+type Options struct {
+	Exporter    string  `toml:"exporter" json:"exporter" comment:"span exporter none, stdout, file or otlp"`
+	ServiceName string  `toml:"service_name" json:"service_name" comment:"the service.name resource attribute"`
+	SampleRatio float64 `toml:"sample_ratio" json:"sample_ratio" comment:"fraction of new traces that are sampled (0-1), sampled parents are always followed"`
+	Endpoint    string  `toml:"endpoint" json:"endpoint" comment:"otlp http collector host:port i.e., localhost:4318"`
+	Insecure    bool    `toml:"insecure" json:"insecure" comment:"use http instead of https for the otlp exporter"`
+	FilePath    string  `toml:"file_path" json:"file_path" comment:"file the spans are written to with the file exporter"`
+}
+
+// Init sets the global tracer provider and the W3C trace context propagator,
+// the returned func flushes the exporter and matches a setup.ShutdownHook
+func Init(o *Options) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	if o == nil || o.Exporter == "" || o.Exporter == None {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exp, closer, err := exporter(o)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL, semconv.ServiceNameKey.String(o.ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing resource %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}
+
+// exporter creates the configured span exporter, closer is set for the file exporter
+func exporter(o *Options) (exp sdktrace.SpanExporter, closer io.Closer, err error) {
+	switch o.Exporter {
+	case Stdout:
+		exp, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case File:
+		f, fErr := os.OpenFile(o.FilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if fErr != nil {
+			return nil, nil, fmt.Errorf("could not open trace file %w", fErr)
+		}
+		closer = f
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case OTLP:
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(o.Endpoint)}
+		if o.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exp, err = otlptracehttp.New(context.Background(), opts...)
+	default:
+		return nil, nil, fmt.Errorf("unknown trace exporter %q", o.Exporter)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s trace exporter %w", o.Exporter, err)
+	}
+	return exp, closer, nil
+}
+
+// Tracer returns a named tracer from the global provider
+func Tracer(component string) trace.Tracer {
+	return otel.Tracer(name + "/" + component)
+}
+
+// Transport wraps the round tripper (http.DefaultTransport when nil) to create a client span
+// for each outbound request and inject the traceparent header
+func Transport(rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(rt)
+}
+
+// Client is an http client for outbound requests that propagates the trace
+var Client = &http.Client{Transport: Transport(nil)}
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rest-api/internal/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// testProvider records the ended spans until the test is done
+func testProvider(t *testing.T) *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return rec
+}
+
+func TestMiddleware(t *testing.T) {
+	rec := testProvider(t)
+	if _, err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	dbErr := errors.New("db is down")
+	router := chi.NewRouter()
+	router.Use(Middleware)
+	router.Get("/v1/kittns/{id}", func(w http.ResponseWriter, r *http.Request) {
+		req := r.Context().Value(logger.RequestKey).(*logger.Log)
+		req.APIError = &logger.Internal{Err: dbErr}
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := &logger.Log{}
+	r := httptest.NewRequest(http.MethodGet, "/v1/kittns/7", nil)
+	r.Header.Set("traceparent", parent)
+	r = r.WithContext(context.WithValue(r.Context(), logger.RequestKey, req))
+	router.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	s := spans[0]
+	if s.Name() != "GET /v1/kittns/{id}" {
+		t.Errorf("expected the span to be named after the route, got %s", s.Name())
+	}
+	if s.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || s.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("expected the trace to continue from the traceparent, got %v", s.Parent())
+	}
+	if req.TraceID != s.SpanContext().TraceID().String() || req.SpanID != s.SpanContext().SpanID().String() {
+		t.Errorf("expected the ids on the request log, got %s %s", req.TraceID, req.SpanID)
+	}
+	if s.Status().Code != codes.Error {
+		t.Errorf("expected an error status, got %v", s.Status())
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, a := range s.Attributes() {
+		attrs[a.Key] = a.Value
+	}
+	if attrs["http.route"].AsString() != "/v1/kittns/{id}" || attrs["http.status_code"].AsInt64() != 500 {
+		t.Errorf("unexpected attributes %v", s.Attributes())
+	}
+	if len(s.Events()) != 1 || s.Events()[0].Name != "exception" {
+		t.Errorf("expected the error to be recorded, got %v", s.Events())
+	}
+}
+
+func TestInitExporter(t *testing.T) {
+	if _, err := Init(&Options{Exporter: "jaeger"}); err == nil {
+		t.Error("expected an unknown exporter error")
+	}
+
+	prev := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(prev)
+	shutdown, err := Init(&Options{Exporter: File, FilePath: t.TempDir() + "/spans.json", SampleRatio: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
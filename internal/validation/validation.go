@@ -0,0 +1,190 @@
+// Package validation parses the validate struct tag rules of request bodies and params,
+// setup checks the request values against the rules and openapi adds them to the schemas.
+// Rules are comma separated, regex must be the last rule as it may contain commas
+//
+//	required        the value must not be the zero value
+//	min=1,max=10    numeric range (inclusive)
+//	len=5           exact length of a string, slice or map
+//	minlen=1        minimum length of a string, slice or map
+//	maxlen=50       maximum length of a string, slice or map
+//	enum=a|b|c      the value must be one of the listed values
+//	regex=^[a-z]+$  the string must match the regular expression
+//
+// i.e., Name string `json:"name" validate:"minlen=1,maxlen=50"`
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tag is the struct tag with the rules
+const Tag = "validate"
+
+// Rule is a parsed rule of a validate tag
+type Rule struct {
+	Key   string         // required, min, max, len, minlen, maxlen, enum or regex
+	Arg   string         // the argument as it's written in the tag
+	Num   float64        // the min or max limit
+	Len   int            // the len, minlen or maxlen limit
+	Enum  []string       // the enum options
+	Regex *regexp.Regexp // the compiled regex
+}
+
+// Rules are the parsed rules of a tag in the order they're written
+type Rules []Rule
+
+// cache keeps the parsed rules by tag so each tag is only parsed once
+var cache sync.Map
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Parse parses the rules of the tag, an unknown rule or invalid argument is an error
+func Parse(tag string) (Rules, error) {
+	if rs, found := cache.Load(tag); found {
+		return rs.(Rules), nil
+	}
+
+	var rs Rules
+	for s := tag; s != ""; {
+		var rule string
+		if strings.HasPrefix(strings.TrimSpace(s), "regex=") {
+			rule, s = s, ""
+		} else {
+			rule, s, _ = strings.Cut(s, ",")
+		}
+		key, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		r := Rule{Key: key, Arg: arg}
+
+		var err error
+		switch key {
+		case "":
+			continue
+		case "required":
+		case "min", "max":
+			if r.Num, err = strconv.ParseFloat(arg, 64); err != nil {
+				return nil, fmt.Errorf("invalid %s rule %q, it needs a number", key, arg)
+			}
+		case "len", "minlen", "maxlen":
+			if r.Len, err = strconv.Atoi(arg); err != nil || r.Len < 0 {
+				return nil, fmt.Errorf("invalid %s rule %q, it needs a length", key, arg)
+			}
+		case "enum":
+			if arg == "" {
+				return nil, fmt.Errorf("enum rule needs values i.e., enum=a|b|c")
+			}
+			r.Enum = strings.Split(arg, "|")
+		case "regex":
+			if r.Regex, err = regexp.Compile(arg); err != nil {
+				return nil, fmt.Errorf("invalid regex rule %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown validation rule %q", key)
+		}
+		rs = append(rs, r)
+	}
+
+	cache.Store(tag, rs)
+	return rs, nil
+}
+
+// Required returns true when the rules have the required rule
+func (rs Rules) Required() bool {
+	for _, r := range rs {
+		if r.Key == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckType returns an error when a rule can't be used with the type i.e., min on a string,
+// the rules of interface types can't be checked until there's a value
+func (rs Rules) CheckType(t reflect.Type) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface {
+		return nil
+	}
+
+	for _, r := range rs {
+		switch r.Key {
+		case "min", "max":
+			if !Numeric(t.Kind()) {
+				return fmt.Errorf("%s rule needs a number, not %s", r.Key, t)
+			}
+		case "len", "minlen", "maxlen":
+			if !HasLen(t.Kind()) {
+				return fmt.Errorf("%s rule needs a string, slice or map, not %s", r.Key, t)
+			}
+		case "regex":
+			if t.Kind() != reflect.String {
+				return fmt.Errorf("regex rule needs a string, not %s", t)
+			}
+		}
+	}
+	return nil
+}
+
+// Struct checks the validate tags of the type's struct fields, and the fields of nested
+// structs, slices and maps, parse and can be used with the field's type
+func Struct(t reflect.Type) error {
+	return checkStruct(t, "", make(map[reflect.Type]bool))
+}
+
+func checkStruct(t reflect.Type, path string, seen map[reflect.Type]bool) error {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := path + sf.Name
+		if tag := sf.Tag.Get(Tag); tag != "" {
+			rs, err := Parse(tag)
+			if err == nil {
+				err = rs.CheckType(sf.Type)
+			}
+			if err != nil {
+				return fmt.Errorf("field %s %w", name, err)
+			}
+		}
+		if err := checkStruct(sf.Type, name+".", seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Numeric returns true for the int, uint and float kinds
+func Numeric(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// HasLen returns true for the kinds with a length
+func HasLen(k reflect.Kind) bool {
+	switch k {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+	return false
+}
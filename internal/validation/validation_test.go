@@ -0,0 +1,106 @@
+package validation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	rs, err := Parse("required, min=1,max=10,enum=a|b,regex=^[a-z,]+$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 5 || !rs.Required() {
+		t.Fatalf("unexpected rules %+v", rs)
+	}
+	if rs[1].Num != 1 || rs[2].Num != 10 {
+		t.Errorf("unexpected limits %v %v", rs[1].Num, rs[2].Num)
+	}
+	if strings.Join(rs[3].Enum, ",") != "a,b" {
+		t.Errorf("unexpected enum %v", rs[3].Enum)
+	}
+	if rs[4].Regex == nil || !rs[4].Regex.MatchString("a,b") {
+		t.Errorf("expected the regex to keep its comma, got %+v", rs[4])
+	}
+
+	// parsed tags are cached
+	again, _ := Parse("required, min=1,max=10,enum=a|b,regex=^[a-z,]+$")
+	if &again[0] != &rs[0] {
+		t.Error("expected the cached rules")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tag := range []string{
+		"minimum=1",
+		"min=a",
+		"maxlen=-1",
+		"len=x",
+		"enum=",
+		"regex=[a-",
+	} {
+		if _, err := Parse(tag); err == nil {
+			t.Errorf("%s expected an error", tag)
+		}
+	}
+}
+
+func TestCheckType(t *testing.T) {
+	cases := []struct {
+		tag  string
+		v    any
+		fail bool
+	}{
+		{tag: "min=1", v: 0},
+		{tag: "min=1", v: new(float32)},
+		{tag: "min=1", v: "", fail: true},
+		{tag: "maxlen=5", v: ""},
+		{tag: "maxlen=5", v: []int{}},
+		{tag: "maxlen=5", v: 0, fail: true},
+		{tag: "regex=^a$", v: ""},
+		{tag: "regex=^a$", v: 1, fail: true},
+		{tag: "required,enum=1|2", v: 0},
+	}
+	for _, c := range cases {
+		rs, err := Parse(c.tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = rs.CheckType(reflect.TypeOf(c.v))
+		if (err != nil) != c.fail {
+			t.Errorf("%s on %T expected fail %v, got %v", c.tag, c.v, c.fail, err)
+		}
+	}
+
+	var anyValue any
+	rs, _ := Parse("min=1")
+	if err := rs.CheckType(reflect.TypeOf(&anyValue).Elem()); err != nil {
+		t.Errorf("interface types can't be checked %v", err)
+	}
+}
+
+type toy struct {
+	Kind string `validate:"min=1"`
+}
+
+type kitten struct {
+	Name string `validate:"minlen=1"`
+	Toys []toy
+	Next *kitten
+}
+
+func TestStruct(t *testing.T) {
+	err := Struct(reflect.TypeOf(kitten{}))
+	if err == nil || !strings.Contains(err.Error(), "field Toys.Kind min rule needs a number") {
+		t.Errorf("expected the nested toy kind error, got %v", err)
+	}
+
+	type valid struct {
+		Name string `validate:"required,maxlen=50"`
+		Cute int    `validate:"min=0,max=10"`
+	}
+	if err := Struct(reflect.TypeOf(&valid{})); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
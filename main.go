@@ -1,36 +1,104 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
-
+	"os"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/hydronica/go-config"
+	"github.com/rest-api/db"
+	"github.com/rest-api/internal/auth"
 	"github.com/rest-api/internal/logger"
+	"github.com/rest-api/internal/metrics"
+	"github.com/rest-api/internal/ratelimit"
 	"github.com/rest-api/internal/setup"
+	"github.com/rest-api/internal/stats"
+	"github.com/rest-api/internal/tracing"
 	"github.com/rest-api/internal/version"
 	"github.com/rest-api/routes"
 )
 
+// redact is the default request log redaction
+var redact = &logger.Redaction{
+	Fields:      []string{"password", "secret", "token", "access_token", "refresh_token", "api_key", "ssn", "card_number"},
+	Headers:     []string{"Authorization", "X-API-Key", "X-Forwarded-For", "Referer"},
+	MaskHeaders: []string{"X-API-Key"},
+	MaxBodySize: 64 << 10, // 64KB
+}
+
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	c := &setup.Config{
-		Log:    &logger.Options{},
-		Port:   9876, // default port
-		Routes: make(setup.Endpoints),
+		Log:       &logger.Options{Redact: redact, Capture: &logger.Capture{Status: []string{"4xx", "5xx"}}},
+		DB:        &db.Options{AutoMigrate: true},
+		Auth:      &auth.Options{JWT: &auth.JWTOptions{}},
+		RateLimit: &ratelimit.Policy{Window: time.Minute, KeyBy: ratelimit.IP},
+		Tracing:   &tracing.Options{Exporter: tracing.None, ServiceName: "rest-api", SampleRatio: 1},
+		Port:      9876, // default port
+		Routes:    make(setup.Endpoints),
+
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    2 * time.Minute,
+		IdleTimeout:     2 * time.Minute,
+		ShutdownTimeout: 30 * time.Second,
+		ShutdownDelay:   5 * time.Second, // time for load balancers to see the failing readiness probe
 	}
 
 	config.New(c).Version(version.Get()).LoadOrDie()
 
 	c.Log.Debug = c.Debug
 	c.Log.Color = c.ColorLog
-	c.Log.InitLogger()  // initial the request logger
-	setup.InitConfig(c) // initialize the config
-	routes.InitRoutes() // adds the routes to the setup
+	if err := c.Log.InitLogger(); err != nil { // initial the request and app loggers
+		fatal(err)
+	}
+	// registered first so the sinks are flushed after the other shutdown hooks have logged
+	setup.OnShutdown(c.Log.Close)
+	c.Log.Observe(metrics.Recorder{})
+	metrics.ObserveSinks(c.Log.SinkStats)
+	c.Log.Observe(stats.Recorder{})
+	if err := setup.InitConfig(c); err != nil { // initialize the config
+		fatal(err)
+	}
+
+	if c.Migrate {
+		if err := migrate(c); err != nil {
+			fatal(err)
+		}
+		setup.Shutdown(context.Background())
+		return
+	}
+
+	if err := auth.Init(c.Auth); err != nil {
+		fatal(err)
+	}
+
+	shutdownTracing, err := tracing.Init(c.Tracing)
+	if err != nil {
+		fatal(err)
+	}
+	setup.OnShutdown(shutdownTracing)
+
+	// the db is opened and migrated before any route start hooks run
+	setup.OnStart(func() error {
+		if err := db.Open(c.DB); err != nil {
+			return err
+		}
+		if c.DB.AutoMigrate {
+			return db.MigrateUp(context.Background(), false)
+		}
+		return nil
+	})
+	setup.OnShutdown(db.Close)
+
+	setup.AddCheck(setup.Check{Name: "db", Fn: db.Ping})
+	setup.AddCheck(setup.Check{Name: "request_log", Liveness: true, Fn: c.Log.Check})
+
+	if err := routes.InitRoutes(); err != nil { // adds the routes to the setup
+		fatal(err)
+	}
 
 	// custom handler methods to avoid logging
 	setup.Mux().MethodNotAllowed(NotAllowed)
@@ -42,26 +110,53 @@ func main() {
 	setup.Mux().Use(middleware.RequestID)
 	setup.Mux().Use(Cors())
 	setup.Mux().Use(middleware.StripSlashes)
+	setup.Mux().Use(middleware.Compress(9)) // before the request logger so it records the uncompressed response
 	setup.Mux().Use(c.Log.WriteRequest)
-	setup.Mux().Use(middleware.Compress(9))
-	setup.AddRoutes()
+	setup.Mux().Use(tracing.Middleware)
+	setup.Mux().Use(setup.Recoverer) // panics after the request logger are written as a 500 error
+	if err := setup.AddRoutes(); err != nil {
+		fatal(err)
+	}
 
 	c.Log.Pretty = c.PrettyLog
 
-	log.Println("api documentation at /docs")
+	slog.Info("api documentation at /docs")
 	if c.Log.Color {
-		log.Println("enabled color output for request logs")
+		slog.Info("enabled color output for request logs")
 	}
 
+	if err := setup.BuildDocs(); err != nil {
+		slog.Error("could not build openapi spec", "error", err)
+	}
 	if c.BuildDocs {
-		err := setup.BuildDocs()
-		if err != nil {
-			log.Println("error building swagger spec", err.Error())
+		if err := setup.WriteDocs("./openapi.json"); err != nil {
+			slog.Error("could not write openapi spec", "error", err)
 		}
 	}
 
-	log.Printf("running api on port %d", c.Port)
-	http.ListenAndServe(fmt.Sprintf(":%d", c.Port), setup.Mux())
+	if err := setup.Serve(); err != nil {
+		fatal(err)
+	}
+}
+
+// fatal logs the error, runs the shutdown hooks so the request log sinks are flushed and exits
+func fatal(err error) {
+	slog.Error(err.Error())
+	setup.Shutdown(context.Background())
+	os.Exit(1)
+}
+
+// migrate runs the db migrations for the -migrate flag
+func migrate(c *setup.Config) error {
+	if err := db.Open(c.DB); err != nil {
+		return err
+	}
+	defer db.Close(context.Background())
+
+	if c.Rollback > 0 {
+		return db.MigrateDown(context.Background(), c.Rollback, c.DryRun)
+	}
+	return db.MigrateUp(context.Background(), c.DryRun)
 }
 
 func NotAllowed(rw http.ResponseWriter, r *http.Request) {
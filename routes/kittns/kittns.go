@@ -1,40 +1,101 @@
 package kittns
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"strconv"
+	"time"
 
-	"github.com/go-chi/chi/v5"
-	jsoniter "github.com/json-iterator/go"
+	"github.com/rest-api/db"
+	"github.com/rest-api/internal/auth"
+	"github.com/rest-api/internal/listquery"
 	"github.com/rest-api/internal/logger"
+	"github.com/rest-api/internal/ratelimit"
 	"github.com/rest-api/internal/setup"
 )
 
-// package kittns is an exmaple api
+// package kittns is an exmaple api backed by the db package
 // you would just delete the kittns folder
 // then add the routes that you need for your api
 
-var json = jsoniter.ConfigFastest
+// writeAuth are the auth methods accepted by the endpoints that change kittns,
+// one of them must be configured in auth_options or the api won't start
+var writeAuth = auth.Methods{auth.APIKey, auth.Basic, auth.JWT}
 
 type Kitten struct {
 	ID     int    `json:"id,omitempty"`
-	Name   string `json:"name"`
-	Breed  string `json:"breed"`
-	Fluffy int    `json:"fluffiness"`
-	Cute   int    `json:"cuteness"`
+	Name   string `json:"name" validate:"minlen=1,maxlen=50"`
+	Breed  string `json:"breed" validate:"maxlen=50,regex=^[A-Za-z ]*$"`
+	Fluffy int    `json:"fluffiness" validate:"min=0,max=10"`
+	Cute   int    `json:"cuteness" validate:"min=0,max=10"`
 }
 
-func Setup() {
-	setup.AddEndpoints(
+func Setup() error {
+	return setup.AddEndpoints(
 		GetKittensEP(),
 		KittenEP(),
 		RMKittenEP(),
 		AddKittnEP(),
+		UpdateKittnEP(),
 	)
 }
 
+// scanKitten reads a kittns row into a Kitten
+func scanKitten(s db.Scanner) (k Kitten, err error) {
+	err = s.Scan(&k.ID, &k.Name, &k.Breed, &k.Fluffy, &k.Cute)
+	return k, err
+}
+
+func insertKitten(ctx context.Context, q db.Querier, k Kitten) (int, error) {
+	res, err := db.Exec(ctx, q,
+		`INSERT INTO kittns (name, breed, fluffiness, cuteness) VALUES (?, ?, ?, ?)`,
+		k.Name, k.Breed, k.Fluffy, k.Cute)
+	if err != nil {
+		return 0, fmt.Errorf("could not insert kittn %w", err)
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// kittnReq is the request for endpoints with the {id} path param
+type kittnReq struct {
+	ID int `path:"id"`
+}
+
+// kittnUpdate is the request body and {id} path param for updating a kittn
+type kittnUpdate struct {
+	ID int `path:"id" json:"-"`
+	Kitten
+}
+
+// errNotFound is returned by the endpoints with the {id} path param
+var errNotFound = setup.ErrorResp{
+	Key:         "not_found",
+	Code:        http.StatusNotFound,
+	Msg:         "kittn id was not found: %d",
+	Description: "there isn't a kittn with the id",
+}
+
+func notFound(ctx context.Context, id int) error {
+	e, _ := setup.EndpointFromContext(ctx)
+	return e.Fail(errNotFound.Key, id)
+}
+
+// kittnList is the paging, sort and filters for listing kittns
+var kittnList = &listquery.Spec{
+	Fields: []listquery.Field{
+		{Name: "id", Type: listquery.Int, Sort: true},
+		{Name: "name", Ops: []listquery.Op{listquery.Eq, listquery.Like}, Sort: true, Description: "the kittn's name"},
+		{Name: "breed", Ops: []listquery.Op{listquery.Eq, listquery.In}, Sort: true, Description: "the kittn's breed"},
+		{Name: "fluffy", Column: "fluffiness", Type: listquery.Int, Ops: []listquery.Op{listquery.Eq, listquery.Gte, listquery.Lte}, Sort: true, Description: "the fluffiness factor"},
+		{Name: "cute", Column: "cuteness", Type: listquery.Int, Ops: []listquery.Op{listquery.Eq, listquery.Gte, listquery.Lte}, Sort: true, Description: "the cuteness factor"},
+	},
+	DefaultSort: "id",
+	Key:         "id",
+}
+
 func GetKittensEP() setup.Endpoint {
 	e := setup.Endpoint{
 		Name:         "Get All Kittns",
@@ -43,32 +104,39 @@ func GetKittensEP() setup.Endpoint {
 		Path:         "/",
 		Methods:      setup.Methods{setup.GET},
 		ResponseType: setup.ContentJSON,
-		ResponseBody: []Kitten{ // these are example values to be used in the api docs
-			{ID: 1, Name: "Fluffums", Breed: "calico", Fluffy: 6, Cute: 7},
-			{ID: 2, Name: "Max", Breed: "calico", Fluffy: 5, Cute: 10},
+		ResponseBody: listquery.Page[Kitten]{ // these are example values to be used in the api docs
+			Data: []Kitten{
+				{ID: 1, Name: "Fluffums", Breed: "calico", Fluffy: 6, Cute: 7},
+				{ID: 2, Name: "Max", Breed: "calico", Fluffy: 5, Cute: 10},
+			},
+			Total: 2,
+			Limit: 20,
 		},
-		Description: "This endpoint retrieves all kittns",
-		HandlerFunc: GetKittens,
+		Description: "This endpoint retrieves a page of kittns",
+		HandlerFunc: setup.Typed(GetKittens),
+		List:        kittnList,
 	}
 
 	return e
 }
 
-func GetKittens(w http.ResponseWriter, r *http.Request) error {
-	var err error
-	var respBody []byte
+func GetKittens(ctx context.Context, q listquery.Query) (listquery.Page[Kitten], error) {
+	where, args := q.Where()
+	total, err := db.Get(ctx, db.Conn(), func(s db.Scanner) (n int, err error) {
+		err = s.Scan(&n)
+		return n, err
+	}, `SELECT COUNT(*) FROM kittns`+where, args...)
+	if err != nil {
+		return listquery.Page[Kitten]{}, fmt.Errorf("could not count kittns %w", err)
+	}
 
-	// Normally you would query a database or api to get the data you needed
-	// this is just using the example from the endpoint object
-	respBody, err = json.Marshal(GetKittensEP().ResponseBody)
+	query, args := q.SQL(`SELECT id, name, breed, fluffiness, cuteness FROM kittns`)
+	kl, err := db.Select(ctx, db.Conn(), scanKitten, query, args...)
 	if err != nil {
-		return fmt.Errorf("marshal error for response body %w", err)
+		return listquery.Page[Kitten]{}, fmt.Errorf("could not query kittns %w", err)
 	}
 
-	w.Header().Set("Content-Type", setup.ContentJSON)
-	w.WriteHeader(http.StatusOK)
-	w.Write(respBody)
-	return nil
+	return listquery.NewPage(q, kl, total), nil
 }
 
 func KittenEP() setup.Endpoint {
@@ -81,41 +149,27 @@ func KittenEP() setup.Endpoint {
 		ResponseType: setup.ContentJSON,
 		ResponseBody: Kitten{ID: 1, Name: "Fluffums", Breed: "calico", Fluffy: 6, Cute: 7}, // example for docs
 		Description:  "This endpoint retrieves a specific kittn",
-		HandlerFunc:  GetKitten,
+		HandlerFunc:  setup.Typed(GetKitten),
+		Errors:       []setup.ErrorResp{errNotFound},
 		PathParams: []setup.Param{
-			{Name: "id", Description: "the id for a kittn"},
+			{Name: "id", Description: "the id for a kittn", Type: setup.Int, Validate: "min=1"},
 		},
 	}
 
 	return e
 }
 
-func GetKitten(w http.ResponseWriter, r *http.Request) error {
-	var err error
-	var respBody []byte
-	kID := chi.URLParam(r, "id")
-
-	// Normally you would query a database or api to get the data you needed
-	// this is just using the example from the endpoint object
-	kl := GetKittensEP().ResponseBody.([]Kitten)
-	for _, k := range kl {
-		if id, _ := strconv.Atoi(kID); k.ID == id {
-			respBody, err = json.Marshal(k)
-			if err != nil {
-				return fmt.Errorf("marshal error for response body %w", err)
-			}
-
-			w.Header().Set("Content-Type", setup.ContentJSON)
-			w.WriteHeader(http.StatusOK)
-			w.Write(respBody)
-			return nil
-		}
+func GetKitten(ctx context.Context, req kittnReq) (k Kitten, err error) {
+	k, err = db.Get(ctx, db.Conn(), scanKitten,
+		`SELECT id, name, breed, fluffiness, cuteness FROM kittns WHERE id = ?`, req.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return k, notFound(ctx, req.ID)
 	}
-
-	return &logger.APIErr{
-		Internal: logger.Internal{Msg: "kittn id was not found"},
-		RespBody: logger.RespBody{Msg: "kittn id was not found: " + kID, Code: 400},
+	if err != nil {
+		return k, fmt.Errorf("could not query kittn %w", err)
 	}
+
+	return k, nil
 }
 
 func RMKittenEP() setup.Endpoint {
@@ -126,23 +180,30 @@ func RMKittenEP() setup.Endpoint {
 		Path:         "/{id}",
 		Methods:      setup.Methods{setup.DELETE},
 		ResponseType: setup.ContentJSON,
+		SuccessCode:  http.StatusAccepted,
 		Description:  "This endpoint deletes a specific kittn",
-		HandlerFunc:  RMKitten,
+		HandlerFunc:  setup.Typed(RMKitten),
+		Errors:       []setup.ErrorResp{errNotFound},
+		Auth:         writeAuth,
+		Scopes:       []string{"kittns:delete"},
 		PathParams: []setup.Param{
-			{Name: "id", Description: "the id for a kittn"},
+			{Name: "id", Description: "the id for a kittn", Type: setup.Int, Validate: "min=1"},
 		},
 	}
 
 	return e
 }
 
-func RMKitten(w http.ResponseWriter, r *http.Request) error {
-	// Normally you would send a delete request to a database or api
-	// this actually doesn't do anything but lie to you :)
+func RMKitten(ctx context.Context, req kittnReq) (setup.Empty, error) {
+	res, err := db.Exec(ctx, db.Conn(), `DELETE FROM kittns WHERE id = ?`, req.ID)
+	if err != nil {
+		return setup.Empty{}, fmt.Errorf("could not delete kittn %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return setup.Empty{}, notFound(ctx, req.ID)
+	}
 
-	w.Header().Set("Content-Type", setup.ContentJSON)
-	w.WriteHeader(http.StatusAccepted)
-	return nil
+	return setup.Empty{}, nil
 }
 
 func AddKittnEP() setup.Endpoint {
@@ -167,8 +228,11 @@ func AddKittnEP() setup.Endpoint {
 			Cute:   3,
 		},
 		ResponseType: setup.ContentJSON,
+		SuccessCode:  http.StatusAccepted,
 		Description:  "This endpoint adds a new kittn",
-		HandlerFunc:  AddKittn,
+		HandlerFunc:  setup.Typed(AddKittn),
+		Auth:         writeAuth,
+		RateLimit:    &ratelimit.Policy{Limit: 10, Window: time.Minute, KeyBy: ratelimit.Principal},
 		JSONFields: []setup.Param{
 			{Name: "name", Required: true, Description: "the kittn's name"},
 			{Name: "breed", Required: true, Description: "the kittn's breed"},
@@ -180,28 +244,64 @@ func AddKittnEP() setup.Endpoint {
 	return e
 }
 
-func AddKittn(w http.ResponseWriter, r *http.Request) error {
-
-	buf, err := io.ReadAll(r.Body)
+func AddKittn(ctx context.Context, k Kitten) (Kitten, error) {
+	var err error
+	k.ID, err = insertKitten(ctx, db.Conn(), k)
 	if err != nil {
-		return logger.NewError(err.Error(), "could not read request body", 406, err)
+		return k, err
 	}
-	k := Kitten{}
-	err = json.Unmarshal(buf, &k)
-	if err != nil {
-		return logger.NewError(err.Error(), "could not parse request body", 406, err)
+
+	logger.Ctx(ctx).Info("added kittn", "id", k.ID, "name", k.Name)
+	return k, nil
+}
+
+func UpdateKittnEP() setup.Endpoint {
+	e := setup.Endpoint{
+		Name:        "Update a Specific Kittn",
+		Version:     "v1",
+		Group:       "kittns",
+		Path:        "/{id}",
+		Methods:     setup.Methods{setup.PUT},
+		RequestType: setup.ContentJSON,
+		RequestBody: Kitten{
+			Name:   "Fluffums",
+			Breed:  "calico",
+			Fluffy: 8,
+			Cute:   9,
+		},
+		ResponseBody: Kitten{ID: 1, Name: "Fluffums", Breed: "calico", Fluffy: 8, Cute: 9},
+		ResponseType: setup.ContentJSON,
+		Description:  "This endpoint updates a specific kittn",
+		HandlerFunc:  setup.Typed(UpdateKittn),
+		Errors:       []setup.ErrorResp{errNotFound},
+		Auth:         writeAuth,
+		PathParams: []setup.Param{
+			{Name: "id", Description: "the id for a kittn", Type: setup.Int, Validate: "min=1"},
+		},
+		JSONFields: []setup.Param{
+			{Name: "name", Required: true, Description: "the kittn's name"},
+			{Name: "breed", Required: true, Description: "the kittn's breed"},
+			{Name: "fluffiness", Description: "the fluffiness factor"},
+			{Name: "cuteness", Description: "the cuteness factor"},
+		},
 	}
 
-	// Normally you would send a insert request to a database or
-	// a create request to another api, this one doesn't do anything
-	k.ID = 3
-	respBody, err := json.Marshal(k)
+	return e
+}
+
+func UpdateKittn(ctx context.Context, req kittnUpdate) (Kitten, error) {
+	k := req.Kitten
+	k.ID = req.ID
+
+	res, err := db.Exec(ctx, db.Conn(),
+		`UPDATE kittns SET name = ?, breed = ?, fluffiness = ?, cuteness = ? WHERE id = ?`,
+		k.Name, k.Breed, k.Fluffy, k.Cute, k.ID)
 	if err != nil {
-		return logger.NewError("there has been a problem", "could not marshal response body", 500, err)
+		return k, fmt.Errorf("could not update kittn %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return k, notFound(ctx, k.ID)
 	}
 
-	w.Header().Set("Content-Type", setup.ContentJSON)
-	w.WriteHeader(http.StatusAccepted)
-	w.Write(respBody)
-	return nil
+	return k, nil
 }
@@ -0,0 +1,98 @@
+package root
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rest-api/internal/logger"
+	"github.com/rest-api/internal/ratelimit"
+	"github.com/rest-api/internal/setup"
+	"github.com/rest-api/internal/version"
+)
+
+var started = time.Now()
+
+// Status is the api's health with the build info
+type Status struct {
+	setup.Health
+	version.Response
+	Uptime string `json:"uptime"`
+}
+
+// probes are called often, they are not logged or rate limited
+var noLimit = &ratelimit.Policy{}
+
+func StatusEP() setup.Endpoint {
+	return setup.Endpoint{
+		Name:         "Status",
+		Path:         "/status",
+		Description:  "Runs all health checks and returns their results with the build info, 503 when a check fails",
+		Methods:      setup.Methods{setup.GET},
+		ResponseType: setup.ContentJSON,
+		HandlerFunc:  StatusHandler,
+		RateLimit:    noLimit,
+		Pretty:       true,
+	}
+}
+
+func HealthzEP() setup.Endpoint {
+	return setup.Endpoint{
+		Name:         "Liveness Probe",
+		Path:         "/healthz",
+		Description:  "Runs the liveness checks, 503 when the process needs to be restarted",
+		Methods:      setup.Methods{setup.GET, setup.HEAD},
+		ResponseType: setup.ContentJSON,
+		HandlerFunc:  HealthzHandler,
+		RateLimit:    noLimit,
+	}
+}
+
+func ReadyzEP() setup.Endpoint {
+	return setup.Endpoint{
+		Name:         "Readiness Probe",
+		Path:         "/readyz",
+		Description:  "Runs all health checks, 503 when a check fails or the api is shutting down",
+		Methods:      setup.Methods{setup.GET, setup.HEAD},
+		ResponseType: setup.ContentJSON,
+		HandlerFunc:  ReadyzHandler,
+		RateLimit:    noLimit,
+	}
+}
+
+func StatusHandler(w http.ResponseWriter, r *http.Request) error {
+	s := Status{
+		Health:   setup.Ready(r.Context()),
+		Response: version.JSON(),
+		Uptime:   time.Since(started).Round(time.Second).String(),
+	}
+	return writeHealth(w, r, s.Status, s)
+}
+
+func HealthzHandler(w http.ResponseWriter, r *http.Request) error {
+	noLog(r)
+	h := setup.RunChecks(r.Context(), true)
+	return writeHealth(w, r, h.Status, h)
+}
+
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) error {
+	noLog(r)
+	h := setup.Ready(r.Context())
+	return writeHealth(w, r, h.Status, h)
+}
+
+// writeHealth writes the health response, a status other than ok is a 503
+func writeHealth(w http.ResponseWriter, r *http.Request, status string, v any) error {
+	code := http.StatusOK
+	if status != setup.StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	return setup.Write(w, r, code, v)
+}
+
+// noLog keeps the probe requests out of the request log
+func noLog(r *http.Request) {
+	if req, ok := r.Context().Value(logger.RequestKey).(*logger.Log); ok {
+		req.NoLog = true
+	}
+}
@@ -0,0 +1,74 @@
+package root
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rest-api/internal/setup"
+)
+
+func TestHealthHandlers(t *testing.T) {
+	var dbErr error
+	setup.AddCheck(setup.Check{Name: "db", Fn: func(context.Context) error { return dbErr }})
+	setup.AddCheck(setup.Check{Name: "request_log", Liveness: true, Fn: func(context.Context) error { return nil }})
+
+	handlers := map[string]setup.Handler{
+		"/status":  StatusHandler,
+		"/healthz": HealthzHandler,
+		"/readyz":  ReadyzHandler,
+	}
+	cases := map[string]struct {
+		dbErr    error
+		draining bool
+		codes    map[string]int
+		body     string
+	}{
+		"healthy": {
+			codes: map[string]int{"/status": http.StatusOK, "/healthz": http.StatusOK, "/readyz": http.StatusOK},
+			body:  `"status":"ok"`,
+		},
+		"failing check": {
+			dbErr: errors.New("db is down"),
+			// the liveness probe only runs the liveness checks
+			codes: map[string]int{"/status": http.StatusServiceUnavailable, "/healthz": http.StatusOK, "/readyz": http.StatusServiceUnavailable},
+			body:  `"error":"db is down"`,
+		},
+		"draining": {
+			draining: true,
+			codes:    map[string]int{"/status": http.StatusServiceUnavailable, "/healthz": http.StatusOK, "/readyz": http.StatusServiceUnavailable},
+			body:     `"status":"shutting down"`,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			dbErr = c.dbErr
+			if c.draining {
+				setup.SetDraining(true)
+				defer setup.SetDraining(false)
+			}
+			for path, h := range handlers {
+				w := httptest.NewRecorder()
+				if err := h(w, httptest.NewRequest(http.MethodGet, path, nil)); err != nil {
+					t.Fatal(err)
+				}
+				if w.Code != c.codes[path] {
+					t.Errorf("%s expected %d, got %d %s", path, c.codes[path], w.Code, w.Body)
+				}
+				if ct := w.Header().Get("Content-Type"); ct != setup.ContentJSON {
+					t.Errorf("%s expected json, got %s", path, ct)
+				}
+				if w.Header().Get("Cache-Control") != "no-store" {
+					t.Errorf("%s expected the response not to be cached", path)
+				}
+				if path == "/readyz" && !strings.Contains(w.Body.String(), c.body) {
+					t.Errorf("%s expected the body to have %s, got %s", path, c.body, w.Body)
+				}
+			}
+		})
+	}
+}
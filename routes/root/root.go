@@ -1,7 +1,7 @@
 package root
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
 
@@ -11,11 +11,15 @@ import (
 )
 
 // adds endpoint routes to the api config
-func Setup() {
-	setup.AddEndpoints(
+func Setup() error {
+	return setup.AddEndpoints(
 		RootEP(),
 		PostTestEP(),
 		ErrorEP(),
+		StatusEP(),
+		HealthzEP(),
+		ReadyzEP(),
+		StatsEP(),
 	)
 }
 
@@ -27,75 +31,55 @@ func RootEP() setup.Endpoint {
 		Description:  "The root path returns the api name and version.",
 		Methods:      setup.Methods{setup.ANY},
 		ResponseType: setup.ContentJSON,
-		HandlerFunc:  RootHandler,
+		HandlerFunc:  setup.Typed(RootHandler),
 		ResponseBody: version.JSON(),
+		Pretty:       true,
 	}
 }
 
 // Handler func for the root / path
-func RootHandler(w http.ResponseWriter, r *http.Request) error {
-	var err error
-	var respBody []byte
-
-	e := RootEP()
-
-	respBody, err = json.MarshalIndent(e.ResponseBody, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal error for response body %w", err)
-	}
-
-	w.Header().Set("Content-Type", setup.ContentJSON)
-	w.WriteHeader(http.StatusOK)
-	w.Write(respBody)
-	return nil
+func RootHandler(ctx context.Context, _ setup.Empty) (version.Response, error) {
+	return version.JSON(), nil
 }
 
 func ErrorEP() setup.Endpoint {
 	return setup.Endpoint{
 		Name:         "Error Path",
 		Path:         "/error",
-		Description:  "This route returns an error depending on given id (none, 1, or 2)",
+		Description:  "This route returns an error depending on given id (none, 1, 2 or panic)",
 		Methods:      setup.Methods{setup.GET},
 		ResponseType: setup.ContentJSON,
 		HandlerFunc:  ErrorHandler,
+		Produces:     []string{setup.ContentJSON},
 		QueryParams: []setup.Param{
-			{Name: "id", Description: "use none, 1 or 2 for different errors"},
+			{Name: "id", Description: "use none, 1, 2 or panic for different errors", Type: setup.Enum, Enum: []string{"1", "2", "panic"}},
 		},
 		ResponseBody: logger.RespBody{
 			Msg:    "you have made a bad request",
 			Code:   http.StatusBadRequest,
 			Status: "Bad Request",
 		},
+		Errors: []setup.ErrorResp{
+			{Key: "bad_request", Code: http.StatusBadRequest, Msg: "you have made a bad request", Description: "returned for id 1"},
+			{Key: "not_acceptable", Code: http.StatusNotAcceptable, Msg: "this is not acceptable", Description: "returned for id 2"},
+		},
 	}
 }
 
 func ErrorHandler(w http.ResponseWriter, r *http.Request) error {
 	id := r.URL.Query().Get("id")
+	e, _ := setup.EndpointFromContext(r.Context())
 
 	if id == "1" {
-		return &logger.APIErr{
-			Internal: logger.Internal{
-				Msg: "internal message number 1",
-				Err: fmt.Errorf("internal error 1"),
-			},
-			RespBody: logger.RespBody{
-				Msg:  "you have made a bad request",
-				Code: http.StatusBadRequest,
-			},
-		}
+		return e.Fail("bad_request")
 	}
 
 	if id == "2" {
-		return &logger.APIErr{
-			Internal: logger.Internal{
-				Msg: "internal message number 2",
-				Err: fmt.Errorf("internal error 2"),
-			},
-			RespBody: logger.RespBody{
-				Msg:  "this is not acceptable",
-				Code: http.StatusNotAcceptable,
-			},
-		}
+		return e.Fail("not_acceptable")
+	}
+
+	if id == "panic" {
+		panic("error route panic")
 	}
 	return fmt.Errorf("an error has occured ")
 }
@@ -117,7 +101,9 @@ func PostTestEP() setup.Endpoint {
 		Methods:      setup.Methods{setup.POST},
 		RequestType:  setup.ContentJSON,
 		ResponseType: setup.ContentJSON,
-		HandlerFunc:  TestHandler,
+		HandlerFunc:  setup.Typed(TestHandler),
+		Pretty:       true,
+		Redact:       &logger.Redaction{Paths: []string{"$.map.test2", "$.array[*].key"}},
 		RequestBody: PostTest{
 			ID:    123,
 			Name:  "Alex Doe",
@@ -128,36 +114,14 @@ func PostTestEP() setup.Endpoint {
 			},
 			Array: []any{"string value", 123.12, map[string]string{"key": "value"}, 6575},
 		},
-		ResponseBody: PostTest{
-			ID:    123,
-			Name:  "Alex Doe",
-			Float: 123.456,
-			Map: map[string]any{
-				"test":  "value",
-				"test2": 432,
-			},
-			Array: []any{"string value", 123.12, map[string]string{"key": "value"}, 6575},
-		},
+		ResponseBody: version.JSON(),
 		JSONFields: []setup.Param{
 			{Name: "id"}, {Name: "name"}, {Name: "float"}, {Name: "map"}, {Name: "array"},
 		},
 	}
 }
 
-// Handler func
-func TestHandler(w http.ResponseWriter, r *http.Request) error {
-	var err error
-	var respBody []byte
-
-	e := RootEP()
-
-	respBody, err = json.MarshalIndent(e.ResponseBody, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal error for response body %w", err)
-	}
-
-	w.Header().Set("Content-Type", setup.ContentJSON)
-	w.WriteHeader(http.StatusOK)
-	w.Write(respBody)
-	return nil
+// Handler func returns the api name and version for the posted body
+func TestHandler(ctx context.Context, _ PostTest) (version.Response, error) {
+	return version.JSON(), nil
 }
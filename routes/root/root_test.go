@@ -0,0 +1,24 @@
+package root
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rest-api/internal/version"
+)
+
+func TestTestHandler(t *testing.T) {
+	version.AppName, version.Version = "rest-api", "v1.2.3"
+	defer func() { version.AppName, version.Version = "-", "-" }()
+
+	resp, err := TestHandler(context.Background(), PostTest{ID: 1, Name: "echo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != version.JSON() || resp.App != "rest-api" || resp.Version != "v1.2.3" {
+		t.Errorf("expected the version response, got %+v", resp)
+	}
+	if _, ok := PostTestEP().ResponseBody.(version.Response); !ok {
+		t.Errorf("expected the docs response body to be the version, got %T", PostTestEP().ResponseBody)
+	}
+}
@@ -0,0 +1,31 @@
+package root
+
+import (
+	"context"
+
+	"github.com/rest-api/internal/setup"
+	"github.com/rest-api/internal/stats"
+	"github.com/rest-api/internal/version"
+)
+
+// Stats is the build info with the runtime and per-route stats
+type Stats struct {
+	version.Response
+	stats.Stats
+}
+
+func StatsEP() setup.Endpoint {
+	return setup.Endpoint{
+		Name:         "Stats",
+		Path:         "/stats",
+		Description:  "Returns the uptime, build info, runtime memory and per-route counts, error rates and p50/p95/p99 latencies for the last 1, 5 and 15 minutes",
+		Methods:      setup.Methods{setup.GET},
+		ResponseType: setup.ContentJSON,
+		HandlerFunc:  setup.Typed(StatsHandler),
+		Pretty:       true,
+	}
+}
+
+func StatsHandler(_ context.Context, _ setup.Empty) (Stats, error) {
+	return Stats{Response: version.JSON(), Stats: stats.Snapshot()}, nil
+}
@@ -6,8 +6,15 @@ import (
 )
 
 // Add all route initializations here
-func InitRoutes() {
-	root.Setup()
-	kittns.Setup()
-	// ... add setup functions here
+func InitRoutes() error {
+	for _, fn := range []func() error{
+		root.Setup,
+		kittns.Setup,
+		// ... add setup functions here
+	} {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return nil
 }